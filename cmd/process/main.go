@@ -0,0 +1,204 @@
+// Command process runs the processing pipeline on a local video file, without
+// Redis or MinIO, to reproduce a job outside the worker. The transcoded MP4 and
+// the other artifacts go to -output-dir; the step timings and the extracted
+// metadata are printed, and the whole result is written as JSON to -result.
+//
+//	go run ./cmd/process -input bad.mov -output-dir out -profile high -steps thumbnails,streaming
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"video-processor/internal/processor"
+	"video-processor/internal/processor/processor-steps"
+)
+
+// stepTiming is the outcome of one executed step.
+type stepTiming struct {
+	Step       string `json:"step"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// result is the JSON document written to -result.
+type result struct {
+	Input           string                         `json:"input"`
+	Output          string                         `json:"output"`
+	Success         bool                           `json:"success"`
+	Error           string                         `json:"error,omitempty"`
+	DurationMs      int64                          `json:"duration_ms"`
+	PipelineVersion int                            `json:"pipeline_version"`
+	SettingsHash    string                         `json:"settings_hash,omitempty"`
+	Profile         string                         `json:"profile"`
+	VideoEncoder    string                         `json:"video_encoder"`
+	Steps           []stepTiming                   `json:"steps"`
+	SkippedSteps    []string                       `json:"skipped_steps,omitempty"`
+	TimedOutSteps   []string                       `json:"timed_out_steps,omitempty"`
+	Metadata        *processor_steps.VideoMetadata `json:"metadata,omitempty"`
+	Artifacts       map[string]string              `json:"artifacts,omitempty"`
+}
+
+func main() {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	defaults := processor.DefaultOptions()
+	opts := defaults
+	var (
+		input, outputDir, resultPath string
+		steps, encoder, profilesFile string
+	)
+	flag.StringVar(&input, "input", "", "video file to process (required)")
+	flag.StringVar(&outputDir, "output-dir", "output", "directory for the MP4 and the other artifacts")
+	flag.StringVar(&resultPath, "result", "", "JSON result file (default: <output-dir>/result.json)")
+	flag.StringVar(&steps, "steps", "", `optional steps to run, comma-separated (default: all; "none": none)`)
+	flag.StringVar(&opts.EncodingProfile, "profile", "", "encoding profile (default: "+processor_steps.DefaultEncodingProfile+")")
+	flag.StringVar(&profilesFile, "profiles-file", "", "YAML/JSON encoding profiles, as ENCODING_PROFILES_FILE")
+	flag.StringVar(&encoder, "encoder", processor_steps.VideoEncoderCPU, "video encoder: auto, nvenc or cpu")
+	flag.StringVar(&opts.NVENCPreset, "nvenc-preset", defaults.NVENCPreset, "NVENC preset p1–p7")
+	flag.BoolVar(&opts.ParallelNonCriticalSteps, "parallel", defaults.ParallelNonCriticalSteps, "run independent steps concurrently")
+	flag.IntVar(&opts.MaxParallelPostTranscodeSteps, "max-parallel", defaults.MaxParallelPostTranscodeSteps, "maximum steps running at once (1–4)")
+	flag.BoolVar(&opts.HLSSingleCommand, "hls-single-command", defaults.HLSSingleCommand, "encode all HLS variants in one FFmpeg command")
+	flag.BoolVar(&opts.HLSSingleCommandFallback, "hls-fallback", defaults.HLSSingleCommandFallback, "fall back to one command per variant if the single command fails")
+	flag.IntVar(&opts.Thumbnails.Count, "thumbnails", 0, "number of thumbnails (default: 5)")
+	flag.IntVar(&opts.Thumbnails.Width, "thumbnail-width", 0, "thumbnail width (default: 320)")
+	flag.IntVar(&opts.Thumbnails.Height, "thumbnail-height", 0, "thumbnail height (default: 180)")
+	flag.Float64Var(&opts.Timeouts.Multiplier, "timeout-multiplier", defaults.Timeouts.Multiplier, "scales the duration-dependent part of the step timeouts")
+	flag.DurationVar(&opts.Timeouts.Ceiling, "timeout-ceiling", defaults.Timeouts.Ceiling, "maximum timeout of a step")
+	flag.Parse()
+
+	if input == "" {
+		fmt.Fprintln(os.Stderr, "process: -input is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	if opts.Steps, err = processor.ParseSteps(steps); err != nil {
+		log.Fatal().Err(err).Msg("Invalid -steps")
+	}
+	if err := opts.Timeouts.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid timeout flags")
+	}
+	if profilesFile != "" {
+		if err := processor_steps.LoadEncodingProfiles(profilesFile); err != nil {
+			log.Fatal().Err(err).Msg("Invalid -profiles-file")
+		}
+	}
+	if resultPath == "" {
+		resultPath = filepath.Join(outputDir, "result.json")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Fatal().Err(err).Msg("Failed to create the output directory")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	probeCtx, probeCancel := context.WithTimeout(ctx, 15*time.Second)
+	opts.VideoEncoder = processor_steps.ResolveVideoEncoder(probeCtx, encoder)
+	probeCancel()
+
+	var mu sync.Mutex
+	var timings []stepTiming
+	opts.OnStepFinished = func(step string, duration time.Duration, err error) {
+		t := stepTiming{Step: step, DurationMs: duration.Milliseconds()}
+		if err != nil {
+			t.Error = err.Error()
+		}
+		mu.Lock()
+		timings = append(timings, t)
+		mu.Unlock()
+	}
+
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	res := result{
+		Input:           input,
+		Output:          filepath.Join(outputDir, base+".mp4"),
+		PipelineVersion: processor.PipelineVersion,
+		Profile:         opts.EncodingProfile,
+		VideoEncoder:    opts.VideoEncoder,
+	}
+	if samePath(res.Output, input) {
+		log.Fatal().Str("output", res.Output).Msg("The output would overwrite the input, use another -output-dir")
+	}
+	if res.Profile == "" {
+		res.Profile = processor_steps.DefaultEncodingProfile
+	}
+
+	start := time.Now()
+	pr, err := processor.ProcessVideo(ctx, input, res.Output, opts)
+	res.DurationMs = time.Since(start).Milliseconds()
+	res.Steps = timings
+	res.Success = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if pr != nil {
+		res.SettingsHash = pr.SettingsHash
+		res.SkippedSteps = pr.SkippedSteps
+		res.TimedOutSteps = pr.TimedOutSteps
+		res.Metadata = pr.Metadata
+		res.Artifacts = pr.Artifacts
+	}
+
+	printSummary(res)
+	if err := writeResult(resultPath, res); err != nil {
+		log.Fatal().Err(err).Msg("Failed to write the result")
+	}
+	fmt.Printf("\nResult written to %s\n", resultPath)
+	if !res.Success {
+		os.Exit(1)
+	}
+}
+
+// samePath reports whether a and b name the same file path.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// printSummary prints the step timings and the metadata of res.
+func printSummary(res result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tDURATION\tERROR")
+	for _, t := range res.Steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Step, time.Duration(t.DurationMs)*time.Millisecond, t.Error)
+	}
+	for _, s := range res.SkippedSteps {
+		fmt.Fprintf(w, "%s\tskipped\t\n", s)
+	}
+	fmt.Fprintf(w, "total\t%s\t%s\n", time.Duration(res.DurationMs)*time.Millisecond, res.Error)
+	w.Flush()
+
+	if m := res.Metadata; m != nil {
+		fmt.Printf("\nDuration %.1fs, %dx%d @ %.2f fps, video %s, audio %s, bitrate %d b/s, size %d bytes\n",
+			m.Duration, m.Width, m.Height, m.FPS, m.VideoCodec, m.AudioCodec, m.Bitrate, m.Size)
+	}
+}
+
+// writeResult writes res as indented JSON to path.
+func writeResult(path string, res result) error {
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+	return nil
+}
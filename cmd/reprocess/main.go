@@ -0,0 +1,63 @@
+// Command reprocess enqueues, at low priority, the videos whose artifacts were
+// produced by a pipeline version lower than -below-version (default: the
+// current one), after restoring their raw from raw-archived/. It reads the
+// same environment as the worker.
+//
+//	go run ./cmd/reprocess -below-version 2 -limit 100 -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"video-processor/config"
+	"video-processor/internal/processor"
+	"video-processor/internal/reprocess"
+	"video-processor/minio"
+	"video-processor/queue"
+)
+
+func main() {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	var opts reprocess.Options
+	flag.IntVar(&opts.BelowVersion, "below-version", processor.PipelineVersion, "reprocess videos whose pipeline version is lower than this")
+	flag.IntVar(&opts.Limit, "limit", 0, "maximum number of videos to enqueue (0: no limit)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list the selected videos without restoring or enqueueing them")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	queue.InitRedisClient(cfg)
+	minio.InitMinioClient(cfg)
+	queue.SetJobArchive(minio.JobRecords{})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := &reprocess.Reprocessor{
+		Candidates: minio.EachArchivedRawVideo,
+		State:      queue.GetJobState,
+		Restore:    minio.RestoreRawVideo,
+		Enqueue:    queue.PublishJob,
+	}
+	report, err := r.Run(ctx, opts)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Reprocessing stopped")
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
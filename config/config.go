@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -14,6 +15,33 @@ type Config struct {
 	RedisHost               string `env:"REDIS_HOST,notEmpty"`
 	ProcessingRequestQueue  string `env:"PROCESSING_REQUEST_QUEUE,notEmpty"`
 	ProcessingFinishedQueue string `env:"PROCESSING_FINISHED_QUEUE,notEmpty"`
+	// QueueBackend: list (LPUSH/BRPOPLPUSH, shared with VidroApi) or streams (consumer group on <queue>:stream).
+	QueueBackend     string `env:"QUEUE_BACKEND" envDefault:"list"`
+	RedisStreamGroup string `env:"REDIS_STREAM_GROUP" envDefault:"video-processor"`
+	// QueuePriorityMode: strict (always high → normal → low) or weighted (QueuePriorityWeights shares).
+	QueuePriorityMode    string `env:"QUEUE_PRIORITY_MODE" envDefault:"strict"`
+	QueuePriorityWeights string `env:"QUEUE_PRIORITY_WEIGHTS" envDefault:"high:6,normal:3,low:1"`
+	// Size thresholds used to derive a priority when the producer does not set one (0 disables).
+	PriorityHighMaxSizeMB int64 `env:"PRIORITY_HIGH_MAX_SIZE_MB" envDefault:"100"`
+	PriorityLowMinSizeMB  int64 `env:"PRIORITY_LOW_MIN_SIZE_MB" envDefault:"1024"`
+	// JobLeaseTTL: lifetime of a job lease; workers renew it every TTL/3 and recovery requeues jobs whose lease expired.
+	JobLeaseTTL time.Duration `env:"JOB_LEASE_TTL" envDefault:"30s"`
+	// Retry backoff: base * 2^(attempt-1) capped at max, spread by ±jitter (fraction). Base 0 = requeue immediately.
+	RetryBackoffBase   time.Duration `env:"RETRY_BACKOFF_BASE" envDefault:"10s"`
+	RetryBackoffMax    time.Duration `env:"RETRY_BACKOFF_MAX" envDefault:"10m"`
+	RetryBackoffJitter float64       `env:"RETRY_BACKOFF_JITTER" envDefault:"0.2"`
+	// RedisMode: standalone, sentinel or cluster. REDIS_HOST is then a comma-separated list
+	// of sentinels (with RedisSentinelMaster) or cluster seed nodes.
+	RedisMode             string `env:"REDIS_MODE" envDefault:"standalone"`
+	RedisSentinelMaster   string `env:"REDIS_SENTINEL_MASTER"`
+	RedisSentinelPassword string `env:"REDIS_SENTINEL_PASSWORD"`
+	RedisUsername         string `env:"REDIS_USERNAME"` // optional: ACL user
+	RedisPassword         string `env:"REDIS_PASSWORD"`
+	// RedisTLS enables TLS; the CA file replaces the system roots, cert + key enable client authentication.
+	RedisTLS         bool   `env:"REDIS_TLS" envDefault:"false"`
+	RedisTLSCAFile   string `env:"REDIS_TLS_CA_FILE"`
+	RedisTLSCertFile string `env:"REDIS_TLS_CERT_FILE"`
+	RedisTLSKeyFile  string `env:"REDIS_TLS_KEY_FILE"`
 
 	// MinIO
 	MinioEndpoint     string `env:"MINIO_ENDPOINT,notEmpty"`
@@ -24,6 +52,10 @@ type Config struct {
 
 	// HTTP
 	HTTPPort string `env:"HTTP_PORT" envDefault:"8080"`
+	// APIToken: bearer token required by POST /jobs and DELETE /jobs/{videoID}; empty disables them.
+	APIToken string `env:"API_TOKEN"`
+	// AdminToken: bearer token required by /admin/* endpoints; empty disables them.
+	AdminToken string `env:"ADMIN_TOKEN"`
 
 	// Observability
 	OTelEndpoint    string `env:"OTEL_ENDPOINT"`                                  // optional: OTLP endpoint (e.g. jaeger:4318); empty = no-op
@@ -34,6 +66,22 @@ type Config struct {
 
 	// Workers
 	WorkerCount int `env:"WORKER_COUNT" envDefault:"0"`
+	// WorkerMaxCount > 0 enables autoscaling between WorkerMinCount and WorkerMaxCount;
+	// 0 keeps a fixed pool of WorkerCount workers.
+	WorkerMaxCount int `env:"WORKER_MAX_COUNT" envDefault:"0"`
+	// WorkerMinCount: autoscaling lower bound (at least 1).
+	WorkerMinCount int `env:"WORKER_MIN_COUNT" envDefault:"1"`
+	// WorkerScaleInterval: time between two autoscaling decisions.
+	WorkerScaleInterval time.Duration `env:"WORKER_SCALE_INTERVAL" envDefault:"15s"`
+	// WorkerScaleDownDelay: how long the queue must stay empty before workers are retired.
+	WorkerScaleDownDelay time.Duration `env:"WORKER_SCALE_DOWN_DELAY" envDefault:"1m"`
+	// WorkerScaleMaxLoad: 1-minute load average per CPU above which workers are retired; 0 = ignore.
+	WorkerScaleMaxLoad float64 `env:"WORKER_SCALE_MAX_LOAD" envDefault:"0.9"`
+	// WorkerScaleMinFreeMemoryMB: available memory below which workers are retired.
+	WorkerScaleMinFreeMemoryMB uint64 `env:"WORKER_SCALE_MIN_FREE_MEMORY_MB" envDefault:"512"`
+	// ShutdownDrainTimeout: on SIGTERM, how long running jobs may finish before they are
+	// cancelled and requeued. Keep it below the orchestrator's termination grace period.
+	ShutdownDrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT" envDefault:"30s"`
 
 	// Processing
 	MaxFileSizeMB                 int64 `env:"MAX_FILE_SIZE_MB" envDefault:"5120"` // 5 GB
@@ -45,6 +93,26 @@ type Config struct {
 	VideoEncoder string `env:"VIDEO_ENCODER" envDefault:"auto"`
 	// NVENCPreset: FFmpeg NVENC preset p1–p7 (Turing+). p5 is a good default for 1080p quality.
 	NVENCPreset string `env:"NVENC_PRESET" envDefault:"p5"`
+	// ProgressUpdateInterval: minimum time between live progress writes to the job state.
+	ProgressUpdateInterval time.Duration `env:"PROGRESS_UPDATE_INTERVAL" envDefault:"2s"`
+	// EnabledSteps: comma-separated optional steps to run (thumbnails, audio, preview, streaming);
+	// empty runs all of them, "none" none. A job spec listing steps overrides it.
+	EnabledSteps string `env:"ENABLED_STEPS"`
+	// EncodingProfilesFile: YAML or JSON file of encoding profiles, merged over the built-in
+	// default/high/fast ones; empty uses the built-ins only.
+	EncodingProfilesFile string `env:"ENCODING_PROFILES_FILE"`
+	// StepTimeoutBase, StepTimeoutMultiplier, StepTimeoutCeiling, StepTimeoutNVENCFactor: step
+	// timeouts scale with the video duration (see processor.TimeoutPolicy); the job budget is their sum.
+	StepTimeoutBase        time.Duration `env:"STEP_TIMEOUT_BASE" envDefault:"30s"`
+	StepTimeoutMultiplier  float64       `env:"STEP_TIMEOUT_MULTIPLIER" envDefault:"1"`
+	StepTimeoutCeiling     time.Duration `env:"STEP_TIMEOUT_CEILING" envDefault:"2h"`
+	StepTimeoutNVENCFactor float64       `env:"STEP_TIMEOUT_NVENC_FACTOR" envDefault:"0.5"`
+	// JobIOTimeout: headroom for the download and the uploads of a job; the job times out
+	// after the pipeline budget plus this, and is retried.
+	JobIOTimeout time.Duration `env:"JOB_IO_TIMEOUT" envDefault:"15m"`
+	// CheckpointsEnabled: checkpoint the transcoded MP4 and the HLS tree to staging/ in MinIO
+	// so that a retry resumes after them; costs one extra upload of both per job.
+	CheckpointsEnabled bool `env:"CHECKPOINTS_ENABLED" envDefault:"true"`
 }
 
 func LoadConfig() *Config {
@@ -58,8 +126,8 @@ func LoadConfig() *Config {
 		log.Fatalf("failed to read environment variables: %v", err)
 	}
 
-	log.Printf("Configuration loaded: redis=%s minio=%s bucket=%s workers=%d",
-		cfg.RedisHost, cfg.MinioEndpoint, cfg.MinioBucketName, cfg.WorkerCount)
+	log.Printf("Configuration loaded: redis=%s (%s) minio=%s bucket=%s workers=%d",
+		cfg.RedisHost, cfg.RedisMode, cfg.MinioEndpoint, cfg.MinioBucketName, cfg.WorkerCount)
 
 	return &cfg
 }
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"video-processor/queue"
+)
+
+const (
+	defaultDLQPageSize = 50
+	maxDLQPageSize     = 500
+)
+
+// DLQListResponse is the body returned by GET /admin/dlq.
+type DLQListResponse struct {
+	Total   int64            `json:"total"`
+	Offset  int64            `json:"offset"`
+	Entries []queue.DLQEntry `json:"entries"`
+}
+
+// DLQActionRequest selects DLQ entries for redrive or purge.
+// All must be set explicitly to act on the whole queue.
+type DLQActionRequest struct {
+	IDs []string `json:"ids,omitempty"`
+	All bool     `json:"all,omitempty"`
+}
+
+// DLQRedriveResponse is the body returned by POST /admin/dlq/redrive.
+type DLQRedriveResponse struct {
+	Redriven []string `json:"redriven"`
+}
+
+// DLQPurgeResponse is the body returned by POST /admin/dlq/purge.
+type DLQPurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// registerAdminRoutes registers the DLQ endpoints behind adminToken. They can
+// redrive and purge jobs, so without a token they are not served at all.
+func registerAdminRoutes(mux *http.ServeMux, adminToken string) {
+	if adminToken == "" {
+		log.Warn().Msg("ADMIN_TOKEN is not set, admin endpoints are disabled")
+		return
+	}
+	mux.Handle("GET /admin/dlq", requireToken(adminToken, http.HandlerFunc(listDLQHandler)))
+	mux.Handle("POST /admin/dlq/redrive", requireToken(adminToken, http.HandlerFunc(redriveDLQHandler)))
+	mux.Handle("POST /admin/dlq/purge", requireToken(adminToken, http.HandlerFunc(purgeDLQHandler)))
+}
+
+// requireToken rejects requests without "Authorization: Bearer <token>".
+// token must not be empty.
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listDLQHandler returns a page of dead-lettered jobs (?offset=&limit=).
+func listDLQHandler(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultDLQPageSize)
+	if err != nil || limit < 1 || limit > maxDLQPageSize {
+		writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxDLQPageSize))
+		return
+	}
+
+	total, err := queue.GetDLQSize()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read dead letter queue size")
+		writeError(w, http.StatusServiceUnavailable, "failed to read dead letter queue")
+		return
+	}
+	entries, err := queue.ListDLQ(offset, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list dead letter queue")
+		writeError(w, http.StatusServiceUnavailable, "failed to read dead letter queue")
+		return
+	}
+	writeJSON(w, http.StatusOK, DLQListResponse{Total: total, Offset: offset, Entries: entries})
+}
+
+// redriveDLQHandler moves the selected entries back to the request queues.
+func redriveDLQHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeDLQAction(w, r)
+	if !ok {
+		return
+	}
+	redriven, err := queue.RedriveDLQ(req.IDs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to redrive dead letter queue")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, DLQRedriveResponse{Redriven: redriven})
+}
+
+// purgeDLQHandler deletes the selected entries from the dead letter queue.
+func purgeDLQHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeDLQAction(w, r)
+	if !ok {
+		return
+	}
+	purged, err := queue.PurgeDLQ(req.IDs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge dead letter queue")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, DLQPurgeResponse{Purged: purged})
+}
+
+func decodeDLQAction(w http.ResponseWriter, r *http.Request) (DLQActionRequest, bool) {
+	var req DLQActionRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return req, false
+	}
+	if len(req.IDs) == 0 && !req.All {
+		writeError(w, http.StatusBadRequest, "either ids or all=true is required")
+		return req, false
+	}
+	if len(req.IDs) > 0 && req.All {
+		writeError(w, http.StatusBadRequest, "ids and all=true are mutually exclusive")
+		return req, false
+	}
+	return req, true
+}
+
+func queryInt(r *http.Request, name string, def int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,258 @@
+// Package api exposes the job submission and status endpoints served by the
+// worker's HTTP server, so producers that do not link the queue package can
+// enqueue videos and track their progress over plain HTTP + JSON.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"video-processor/config"
+	"video-processor/internal/processor"
+	processor_steps "video-processor/internal/processor/processor-steps"
+	"video-processor/minio"
+	"video-processor/queue"
+)
+
+// maxRequestBodyBytes bounds the size of JSON request bodies.
+const maxRequestBodyBytes = 1 << 20
+
+const (
+	defaultJobsPageSize = 50
+	maxJobsPageSize     = 500
+)
+
+// ListJobsResponse is the body returned by GET /jobs. NextCursor is empty on the last page.
+type ListJobsResponse struct {
+	Jobs       []queue.JobState `json:"jobs"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// JobResponse is the body returned by GET /jobs/{videoID}: the job state plus
+// its lifecycle history (oldest event first).
+type JobResponse struct {
+	*queue.JobState
+	History []queue.JobEvent `json:"history"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Notifier is called with the final state of jobs that reach a terminal status
+// inside a request (e.g. a pending job cancelled before any worker took it).
+type Notifier func(state *queue.JobState)
+
+// RegisterRoutes registers the job and admin endpoints on mux.
+// Job endpoints require cfg.APIToken as a bearer token, admin endpoints
+// cfg.AdminToken; each group is only registered when its token is set.
+// notify may be nil.
+func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, notify Notifier) {
+	if notify == nil {
+		notify = func(*queue.JobState) {}
+	}
+	// Job states carry callback URLs and user metadata of every tenant: reads need the token too.
+	if cfg.APIToken != "" {
+		mux.Handle("GET /jobs", requireToken(cfg.APIToken, http.HandlerFunc(listJobsHandler)))
+		mux.Handle("GET /jobs/{videoID}", requireToken(cfg.APIToken, http.HandlerFunc(getJobHandler)))
+		mux.Handle("POST /jobs", requireToken(cfg.APIToken, http.HandlerFunc(submitJobHandler)))
+		mux.Handle("DELETE /jobs/{videoID}", requireToken(cfg.APIToken, cancelJobHandler(notify)))
+	} else {
+		log.Warn().Msg("API_TOKEN is not set, job endpoints are disabled")
+	}
+	registerAdminRoutes(mux, cfg.AdminToken)
+}
+
+// submitJobHandler enqueues a video for processing and returns its initial state.
+// The body is a queue.JobSpec; only video_id is required. When priority is empty
+// it is derived from the raw object size.
+// Returns 409 if the video already has a pending or processing job.
+func submitJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req queue.JobSpec
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	req.VideoID = strings.TrimSpace(req.VideoID)
+	if req.VideoID == "" {
+		writeError(w, http.StatusBadRequest, "video_id is required")
+		return
+	}
+	if strings.Contains(req.VideoID, "/") {
+		writeError(w, http.StatusBadRequest, "video_id must not contain '/'")
+		return
+	}
+	if err := validateSpec(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Priority == "" {
+		req.Priority = derivePriority(req.VideoID)
+	}
+
+	// PublishJob claims the job atomically: of concurrent submissions, one wins.
+	err := queue.PublishJob(req)
+	if errors.Is(err, queue.ErrJobActive) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("videoID", req.VideoID).Msg("Failed to publish job")
+		writeError(w, http.StatusServiceUnavailable, "failed to publish job")
+		return
+	}
+	log.Info().Str("videoID", req.VideoID).Str("priority", string(req.Priority)).Str("tenant", req.Tenant).Msg("Job submitted via HTTP")
+
+	state, err := queue.GetJobState(req.VideoID)
+	if err != nil {
+		// The job is queued; only the read-back failed.
+		writeJSON(w, http.StatusAccepted, queue.JobState{VideoID: req.VideoID, Status: queue.JobStatusPending})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, state)
+}
+
+// validateSpec checks the spec fields that depend on the processor package
+// in addition to JobSpec.Validate.
+func validateSpec(spec *queue.JobSpec) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	for _, step := range spec.Steps {
+		if !processor.IsOptionalStep(step) {
+			return fmt.Errorf("unknown step %q (allowed: %s)", step, strings.Join(processor.OptionalSteps(), ", "))
+		}
+	}
+	if _, ok := processor_steps.LookupEncodingProfile(spec.Profile); !ok {
+		return fmt.Errorf("unknown encoding profile %q", spec.Profile)
+	}
+	if spec.Expired(time.Now()) {
+		return fmt.Errorf("expires_at is in the past")
+	}
+	return nil
+}
+
+// derivePriority stats the raw upload so short videos are routed ahead of long ones.
+// Falls back to normal priority if the object cannot be inspected.
+func derivePriority(videoID string) queue.Priority {
+	size, err := minio.StatVideo(minio.VideoTypeRaw, videoID)
+	if err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to stat raw video, using normal priority")
+		return queue.PriorityNormal
+	}
+	return queue.PriorityForSize(size)
+}
+
+// getJobHandler returns the state and history of a single job.
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	videoID := r.PathValue("videoID")
+	state, err := queue.GetJobState(videoID)
+	if errors.Is(err, queue.ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("videoID", videoID).Msg("Failed to read job state")
+		writeError(w, http.StatusServiceUnavailable, "failed to read job state")
+		return
+	}
+
+	history, err := queue.GetJobEvents(videoID)
+	if err != nil {
+		// The state alone is still useful; history is best effort.
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to read job history")
+		history = []queue.JobEvent{}
+	}
+	writeJSON(w, http.StatusOK, JobResponse{JobState: state, History: history})
+}
+
+// cancelJobHandler cancels a job. Responds 200 with the cancelled state when the
+// job was still waiting, or 202 when its worker was signalled to stop it.
+func cancelJobHandler(notify Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		videoID := r.PathValue("videoID")
+		state, err := queue.CancelJob(videoID)
+		switch {
+		case errors.Is(err, queue.ErrJobNotFound):
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		case errors.Is(err, queue.ErrJobNotCancellable):
+			writeError(w, http.StatusConflict, fmt.Sprintf("job is already %s", state.Status))
+			return
+		case err != nil:
+			log.Error().Err(err).Str("videoID", videoID).Msg("Failed to cancel job")
+			writeError(w, http.StatusServiceUnavailable, "failed to cancel job")
+			return
+		}
+
+		if state.Status == queue.JobStatusCancelled {
+			notify(state)
+			writeJSON(w, http.StatusOK, state)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, state)
+	}
+}
+
+// listJobsHandler returns one page of jobs, newest first, read from the status
+// indexes. Query: status (optional), since (unix seconds), limit, and cursor
+// (next_cursor of the previous page).
+func listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	status := queue.JobStatus(r.URL.Query().Get("status"))
+	if status != "" && !queue.ValidJobStatus(status) {
+		writeError(w, http.StatusBadRequest, "invalid status: "+string(status))
+		return
+	}
+	since, err := queryInt(r, "since", 0)
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, "since must be a unix timestamp in seconds")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultJobsPageSize)
+	if err != nil || limit < 1 || limit > maxJobsPageSize {
+		writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxJobsPageSize))
+		return
+	}
+	var sinceTime time.Time
+	if since > 0 {
+		sinceTime = time.Unix(since, 0)
+	}
+
+	page, err := queue.ListJobs(status, sinceTime, r.URL.Query().Get("cursor"), int(limit))
+	if errors.Is(err, queue.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("status", string(status)).Msg("Failed to list jobs")
+		writeError(w, http.StatusServiceUnavailable, "failed to list jobs")
+		return
+	}
+	writeJSON(w, http.StatusOK, ListJobsResponse{Jobs: page.Jobs, NextCursor: page.NextCursor})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("Failed to write JSON response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
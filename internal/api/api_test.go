@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"video-processor/config"
+	"video-processor/queue"
+)
+
+func newTestMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, &config.Config{APIToken: "api-secret", AdminToken: "secret"}, nil)
+	return mux
+}
+
+func TestSubmitJob_InvalidBody(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"malformed JSON", "{"},
+		{"unknown field", `{"video_id": "v1", "foo": 1}`},
+		{"missing video_id", `{"callback_url": "http://example.com"}`},
+		{"blank video_id", `{"video_id": "   "}`},
+		{"video_id with slash", `{"video_id": "a/b"}`},
+		{"invalid priority", `{"video_id": "v1", "priority": "urgent"}`},
+		{"unknown step", `{"video_id": "v1", "steps": ["transcode"]}`},
+		{"unknown profile", `{"video_id": "v1", "profile": "ultra"}`},
+		{"expired deadline", `{"video_id": "v1", "expires_at": 1000}`},
+		{"negative deadline", `{"video_id": "v1", "expires_at": -1}`},
+		{"too many thumbnails", `{"video_id": "v1", "thumbnails": {"count": 1000000}}`},
+		{"huge thumbnails", `{"video_id": "v1", "thumbnails": {"width": 100000, "height": 100000}}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(c.body))
+			req.Header.Set("Authorization", "Bearer api-secret")
+			rec := httptest.NewRecorder()
+			newTestMux().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rec.Code)
+			}
+			var resp errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error response: %v", err)
+			}
+			if resp.Error == "" {
+				t.Error("expected non-empty error message")
+			}
+		})
+	}
+}
+
+func TestListJobs_InvalidStatus(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/jobs?status=unknown", nil)
+	req.Header.Set("Authorization", "Bearer api-secret")
+	rec := httptest.NewRecorder()
+	newTestMux().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type 'application/json', got '%s'", ct)
+	}
+}
+
+func TestListJobs_InvalidPagination(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=501", "since=-1", "since=yesterday", "cursor=garbage"} {
+		req := httptest.NewRequest(http.MethodGet, "/jobs?"+query, nil)
+		req.Header.Set("Authorization", "Bearer api-secret")
+		rec := httptest.NewRecorder()
+		newTestMux().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestJobs_MethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/jobs", nil)
+	rec := httptest.NewRecorder()
+	newTestMux().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
+	}
+}
+
+func TestJobs_RequireToken(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		path := "/jobs"
+		if method == http.MethodDelete {
+			path = "/jobs/v1"
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"video_id": "v1"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		newTestMux().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected status 401 with the admin token, got %d", method, path, rec.Code)
+		}
+	}
+}
+
+func TestJobs_DisabledWithoutToken(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, &config.Config{}, nil)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req := httptest.NewRequest(method, "/jobs", strings.NewReader(`{"video_id": "v1"}`))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s /jobs: expected status 404 without API_TOKEN, got %d", method, rec.Code)
+		}
+	}
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/admin/dlq", nil)
+	rec := httptest.NewRecorder()
+	newTestMux().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without token, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/dlq", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	newTestMux().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 with wrong token, got %d", rec.Code)
+	}
+}
+
+func TestAdmin_DLQActionValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"redrive without selection", "/admin/dlq/redrive", `{}`},
+		{"purge without selection", "/admin/dlq/purge", `{"ids": []}`},
+		{"ids and all", "/admin/dlq/purge", `{"ids": ["v1"], "all": true}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(c.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			newTestMux().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestAdmin_ListDLQInvalidPaging(t *testing.T) {
+	for _, query := range []string{"?offset=-1", "?limit=0", "?limit=100000", "?offset=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/dlq"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		newTestMux().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestJobResponse_InlinesState(t *testing.T) {
+	resp := JobResponse{
+		JobState: &queue.JobState{VideoID: "v1", Status: queue.JobStatusProcessing},
+		History:  []queue.JobEvent{{Type: queue.EventSubmitted, Status: queue.JobStatusPending}},
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("failed to encode response: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, key := range []string{"video_id", "status", "history"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("expected top-level key %q in %s", key, data)
+		}
+	}
+}
+
+func TestAdmin_DisabledWithoutToken(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, &config.Config{}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/dlq/purge", strings.NewReader(`{"all": true}`))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 without ADMIN_TOKEN, got %d", rec.Code)
+	}
+}
@@ -8,8 +8,12 @@
 package circuitbreaker
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	"video-processor/internal/joberrors"
+
 	"github.com/rs/zerolog/log"
 	"github.com/sony/gobreaker"
 )
@@ -29,6 +33,10 @@ func init() {
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
 			return counts.ConsecutiveFailures >= 5
 		},
+		// A missing or oversized object, or a transfer stopped with its job, says nothing about MinIO's health.
+		IsSuccessful: func(err error) bool {
+			return err == nil || joberrors.IsPermanent(err) || errors.Is(err, context.Canceled)
+		},
 		OnStateChange: func(name string, from, to gobreaker.State) {
 			log.Warn().
 				Str("service", name).
@@ -46,6 +54,10 @@ func init() {
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
 			return counts.ConsecutiveFailures >= 3
 		},
+		// A blocking read interrupted by a retired worker or shutdown is not a Redis failure.
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled)
+		},
 		OnStateChange: func(name string, from, to gobreaker.State) {
 			log.Warn().
 				Str("service", name).
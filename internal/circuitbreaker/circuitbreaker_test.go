@@ -1,10 +1,13 @@
 package circuitbreaker
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
 
+	"video-processor/internal/joberrors"
+
 	"github.com/sony/gobreaker"
 )
 
@@ -38,6 +41,43 @@ func TestRedis_InitialState_Closed(t *testing.T) {
 	}
 }
 
+func TestMinIO_PermanentErrorsDoNotTrip(t *testing.T) {
+	notFound := joberrors.Permanent(joberrors.CodeNotFound, errFailure)
+	for i := 0; i < 10; i++ {
+		MinIO.Execute(func() (interface{}, error) { //nolint:errcheck
+			return nil, notFound
+		})
+	}
+
+	if MinIO.State() != gobreaker.StateClosed {
+		t.Fatalf("permanent errors should not open the MinIO circuit, state: %s", MinIO.State())
+	}
+}
+
+func TestMinIO_CancelledCallsDoNotTrip(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		MinIO.Execute(func() (interface{}, error) { //nolint:errcheck
+			return nil, context.Canceled
+		})
+	}
+
+	if MinIO.State() != gobreaker.StateClosed {
+		t.Fatalf("cancelled calls should not open the MinIO circuit, state: %s", MinIO.State())
+	}
+}
+
+func TestRedis_CancelledCallsDoNotTrip(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		Redis.Execute(func() (interface{}, error) { //nolint:errcheck
+			return nil, context.Canceled
+		})
+	}
+
+	if Redis.State() != gobreaker.StateClosed {
+		t.Fatalf("cancelled calls should not open the Redis circuit, state: %s", Redis.State())
+	}
+}
+
 func TestCircuitBreaker_OpensAfter5ConsecutiveFailures(t *testing.T) {
 	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
 		Name:        "test-minio",
@@ -0,0 +1,73 @@
+// Package joberrors classifies job failures as permanent or transient.
+//
+// Packages that can tell why an operation failed (processor, minio, queue) wrap
+// the error with a Code and a retry class. The failure handler in main.go then
+// retries only transient errors; permanent ones (corrupt input, unsupported
+// codec, file too large, missing source) end the job immediately because a retry
+// would fail the same way. Unclassified errors are treated as transient, which
+// keeps the behavior of code that predates the classification.
+package joberrors
+
+import "errors"
+
+// Code identifies the cause of a job failure. It is persisted in JobState and
+// sent in webhooks, so values must stay stable.
+type Code string
+
+const (
+	CodeInvalidInput     Code = "invalid_input"
+	CodeUnsupportedCodec Code = "unsupported_codec"
+	CodeTooLarge         Code = "too_large"
+	CodeNotFound         Code = "not_found"
+	CodeTransientIO      Code = "transient_io"
+	CodeTimeout          Code = "timeout"
+	// CodeUnknown is reported for errors nobody classified.
+	CodeUnknown Code = "unknown"
+)
+
+// Error is a classified job failure.
+type Error struct {
+	Code      Code
+	Permanent bool
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err as a failure that retrying cannot fix.
+func Permanent(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Permanent: true, Err: err}
+}
+
+// Transient wraps err as a failure that may succeed on retry.
+func Transient(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// IsPermanent reports whether err (or an error it wraps) is a permanent failure.
+func IsPermanent(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Permanent
+}
+
+// CodeOf returns the code of the outermost classified error in err's chain,
+// or CodeUnknown when err is not classified.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,47 @@
+package joberrors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassification_SurvivesWrapping(t *testing.T) {
+	base := errors.New("moov atom not found")
+	err := fmt.Errorf("failed to process video: %w", Permanent(CodeInvalidInput, base))
+
+	if !IsPermanent(err) {
+		t.Error("expected wrapped permanent error to stay permanent")
+	}
+	if code := CodeOf(err); code != CodeInvalidInput {
+		t.Errorf("expected code %s, got %s", CodeInvalidInput, code)
+	}
+	if !errors.Is(err, base) {
+		t.Error("expected the original error to stay reachable via errors.Is")
+	}
+}
+
+func TestClassification_Transient(t *testing.T) {
+	err := Transient(CodeTransientIO, errors.New("connection reset"))
+
+	if IsPermanent(err) {
+		t.Error("expected transient error not to be permanent")
+	}
+	if code := CodeOf(err); code != CodeTransientIO {
+		t.Errorf("expected code %s, got %s", CodeTransientIO, code)
+	}
+}
+
+func TestClassification_Unclassified(t *testing.T) {
+	err := errors.New("something broke")
+
+	if IsPermanent(err) {
+		t.Error("expected unclassified error to be retried")
+	}
+	if code := CodeOf(err); code != CodeUnknown {
+		t.Errorf("expected code %s, got %s", CodeUnknown, code)
+	}
+	if Permanent(CodeNotFound, nil) != nil || Transient(CodeTimeout, nil) != nil {
+		t.Error("expected nil errors to stay nil")
+	}
+}
@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"video-processor/internal/processor/processor-steps"
+	"video-processor/metrics"
+)
+
+// Checkpoints stores the outputs of completed steps outside the worker, so that
+// a retry of the job can resume instead of running them again. Artifacts map
+// artifact names to local files or directory trees, like Artifacts.
+type Checkpoints interface {
+	// Save stores the artifacts of step, completed by the current attempt.
+	Save(ctx context.Context, step string, artifacts map[string]string) error
+	// Restore writes the artifacts of step saved by an earlier attempt of the job
+	// to the local paths in targets. It returns false if there is no checkpoint
+	// with the same pipeline settings, or it is incomplete.
+	Restore(ctx context.Context, step string, targets map[string]string) (bool, error)
+}
+
+// CheckpointedStep is a Step whose outputs are checkpointed when Options.Checkpoints is set.
+type CheckpointedStep interface {
+	Step
+	// CheckpointTargets returns the local path of every artifact of the step, where
+	// a checkpoint is restored.
+	CheckpointTargets(job *Job) Artifacts
+	// ValidateCheckpoint checks restored artifacts before they replace running the step.
+	ValidateCheckpoint(ctx context.Context, artifacts Artifacts) error
+}
+
+type checkpointedStep struct {
+	Step
+	targets  func(job *Job) Artifacts
+	validate func(ctx context.Context, artifacts Artifacts) error
+}
+
+// WithCheckpoint makes the outputs of s checkpointed: targets returns where they
+// are restored, validate checks a restored copy.
+func WithCheckpoint(s Step, targets func(job *Job) Artifacts, validate func(ctx context.Context, artifacts Artifacts) error) Step {
+	return &checkpointedStep{Step: s, targets: targets, validate: validate}
+}
+
+func (s *checkpointedStep) CheckpointTargets(job *Job) Artifacts { return s.targets(job) }
+
+func (s *checkpointedStep) ValidateCheckpoint(ctx context.Context, artifacts Artifacts) error {
+	return s.validate(ctx, artifacts)
+}
+
+// resumeStep restores the checkpoint of s for job, if s is checkpointed and an
+// earlier attempt saved one that validates. Restore failures are logged and
+// make the step run again.
+func resumeStep(ctx context.Context, s Step, job *Job) bool {
+	cs, ok := s.(CheckpointedStep)
+	if !ok || job.Options.Checkpoints == nil {
+		return false
+	}
+	targets := cs.CheckpointTargets(job)
+	restored, err := job.Options.Checkpoints.Restore(ctx, s.Name(), targets)
+	if err != nil {
+		log.Warn().Err(err).Str("step", s.Name()).Msg("Failed to restore step checkpoint, running the step")
+		return false
+	}
+	if !restored {
+		return false
+	}
+	if err := cs.ValidateCheckpoint(ctx, targets); err != nil {
+		log.Warn().Err(err).Str("step", s.Name()).Msg("Invalid step checkpoint, running the step")
+		return false
+	}
+
+	log.Info().Str("step", s.Name()).Msg("Step resumed from checkpoint")
+	metrics.ProcessingStepsTotal.WithLabelValues(s.Name(), "resumed").Inc()
+	trackerFrom(ctx).update(s.Name(), 1)
+	job.addArtifacts(targets)
+	job.mu.Lock()
+	job.resumed = append(job.resumed, s.Name())
+	job.mu.Unlock()
+	return true
+}
+
+// checkpointStep saves the artifacts s produced for job, if s is checkpointed.
+// A failed save only costs the next attempt the step, so it is logged.
+func checkpointStep(ctx context.Context, s Step, job *Job) {
+	cs, ok := s.(CheckpointedStep)
+	if !ok || job.Options.Checkpoints == nil || ctx.Err() != nil {
+		return
+	}
+	artifacts := Artifacts{}
+	for name := range cs.CheckpointTargets(job) {
+		if path := job.Artifact(name); path != "" {
+			artifacts[name] = path
+		}
+	}
+	if err := job.Options.Checkpoints.Save(ctx, s.Name(), artifacts); err != nil {
+		log.Warn().Err(err).Str("step", s.Name()).Msg("Failed to checkpoint step outputs")
+	}
+}
+
+// validateVideoCheckpoint checks a restored MP4 with ffprobe.
+func validateVideoCheckpoint(ctx context.Context, artifacts Artifacts) error {
+	return processor_steps.ValidateVideo(ctx, artifacts[ArtifactVideo])
+}
+
+// validateHLSCheckpoint checks that a restored HLS tree has its master playlist
+// and every variant playlist it references.
+func validateHLSCheckpoint(ctx context.Context, artifacts Artifacts) error {
+	dir := artifacts[ArtifactStreaming]
+	master, err := os.Open(filepath.Join(dir, "master.m3u8"))
+	if err != nil {
+		return fmt.Errorf("failed to open master playlist: %w", err)
+	}
+	defer master.Close()
+
+	variants := 0
+	scanner := bufio.NewScanner(master)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(line))); err != nil {
+			return fmt.Errorf("missing variant playlist %s: %w", line, err)
+		}
+		variants++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read master playlist: %w", err)
+	}
+	if variants == 0 {
+		return fmt.Errorf("master playlist lists no variant")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeCheckpoints keeps checkpoints in memory: step → artifact name → file content.
+type fakeCheckpoints struct {
+	saved map[string]map[string]string
+}
+
+func (f *fakeCheckpoints) Save(ctx context.Context, step string, artifacts map[string]string) error {
+	if f.saved == nil {
+		f.saved = map[string]map[string]string{}
+	}
+	f.saved[step] = map[string]string{}
+	for name, path := range artifacts {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f.saved[step][name] = string(data)
+	}
+	return nil
+}
+
+func (f *fakeCheckpoints) Restore(ctx context.Context, step string, targets map[string]string) (bool, error) {
+	files, ok := f.saved[step]
+	if !ok {
+		return false, nil
+	}
+	for name, path := range targets {
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// encodeStep is a checkpointed step writing "encoded" to out; validate accepts
+// only that content.
+func encodeStep(out string, runs *int) Step {
+	return WithCheckpoint(NewStep("encode", nil, true, StepBudget{Timeout: time.Second}, func(ctx context.Context, job *Job) (Artifacts, error) {
+		*runs++
+		if err := os.WriteFile(out, []byte("encoded"), 0o644); err != nil {
+			return nil, err
+		}
+		return Artifacts{ArtifactVideo: out}, nil
+	}), func(job *Job) Artifacts {
+		return Artifacts{ArtifactVideo: out}
+	}, func(ctx context.Context, a Artifacts) error {
+		if data, _ := os.ReadFile(a[ArtifactVideo]); string(data) != "encoded" {
+			return errors.New("corrupt")
+		}
+		return nil
+	})
+}
+
+func TestRunSteps_CheckpointsAndResumes(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	store := &fakeCheckpoints{}
+	runs := 0
+
+	first := &Job{Options: Options{Checkpoints: store}}
+	if err := runSteps(context.Background(), []Step{encodeStep(out, &runs)}, first, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if store.saved["encode"][ArtifactVideo] != "encoded" {
+		t.Fatalf("expected the step outputs to be checkpointed, got %v", store.saved)
+	}
+
+	os.Remove(out)
+	retry := &Job{Options: Options{Checkpoints: store}}
+	if err := runSteps(context.Background(), []Step{encodeStep(out, &runs)}, retry, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected the retry to resume instead of running the step, ran %d times", runs)
+	}
+	if got := retry.ResumedSteps(); len(got) != 1 || got[0] != "encode" {
+		t.Errorf("expected encode to be recorded as resumed, got %v", got)
+	}
+	if retry.Artifact(ArtifactVideo) != out {
+		t.Errorf("expected the restored artifact, got %v", retry.Artifacts())
+	}
+}
+
+func TestRunSteps_InvalidCheckpointRunsTheStep(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	store := &fakeCheckpoints{saved: map[string]map[string]string{"encode": {ArtifactVideo: "truncated"}}}
+	runs := 0
+
+	job := &Job{Options: Options{Checkpoints: store}}
+	if err := runSteps(context.Background(), []Step{encodeStep(out, &runs)}, job, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if runs != 1 || len(job.ResumedSteps()) != 0 {
+		t.Errorf("expected an invalid checkpoint to be ignored, ran %d times, resumed %v", runs, job.ResumedSteps())
+	}
+	if store.saved["encode"][ArtifactVideo] != "encoded" {
+		t.Errorf("expected the new outputs to replace the checkpoint, got %v", store.saved)
+	}
+}
+
+func TestValidateHLSCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	artifacts := Artifacts{ArtifactStreaming: dir}
+
+	if err := validateHLSCheckpoint(context.Background(), artifacts); err == nil {
+		t.Error("expected a missing master playlist to be rejected")
+	}
+	write("master.m3u8", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=464000\n240p/playlist.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=896000\n360p/playlist.m3u8\n")
+	write("240p/playlist.m3u8", "#EXTM3U\n")
+	if err := validateHLSCheckpoint(context.Background(), artifacts); err == nil {
+		t.Error("expected a missing variant playlist to be rejected")
+	}
+	write("360p/playlist.m3u8", "#EXTM3U\n")
+	if err := validateHLSCheckpoint(context.Background(), artifacts); err != nil {
+		t.Errorf("expected a complete tree to be valid, got %v", err)
+	}
+}
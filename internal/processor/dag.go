@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"video-processor/internal/joberrors"
+	"video-processor/metrics"
+)
+
+// checkSteps verifies that step names are unique, that every dependency is a
+// known step and that the dependencies form no cycle.
+func checkSteps(steps []Step) error {
+	deps := make(map[string][]string, len(steps))
+	for _, s := range steps {
+		if _, dup := deps[s.Name()]; dup {
+			return fmt.Errorf("step %q defined twice", s.Name())
+		}
+		deps[s.Name()] = s.Deps()
+	}
+	for _, s := range steps {
+		for _, d := range s.Deps() {
+			if _, ok := deps[d]; !ok {
+				return fmt.Errorf("step %q depends on unknown step %q", s.Name(), d)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(steps))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through step %q", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, d := range deps[name] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, s := range steps {
+		if err := visit(s.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxParallelSteps returns how many steps may run at once: 1 when
+// ParallelNonCriticalSteps is off, else MaxParallelPostTranscodeSteps clamped to [1, 4].
+func maxParallelSteps(opts Options) int {
+	if !opts.ParallelNonCriticalSteps {
+		return 1
+	}
+	return max(1, min(opts.MaxParallelPostTranscodeSteps, 4))
+}
+
+type stepOutcome struct {
+	step Step
+	err  error
+}
+
+// runSteps executes steps as a dependency graph: a step starts once all its
+// dependencies have finished, at most maxParallel at a time, ready steps in
+// the order of steps. Optional steps disabled in job.Options are skipped.
+// The first critical failure cancels the running steps, starts no new one
+// and is returned once the running steps have returned; non-critical failures
+// are only logged.
+//
+// The whole run is bounded by the pipeline budget, the sum of the step
+// timeouts; it grows once the analyze step has set the metadata of the job.
+// Exceeding it cancels the running steps like a critical failure. Non-critical
+// steps cancelled by it are recorded as timed out (see Job.TimedOutSteps): if
+// no critical step was running, the run still succeeds without their artifacts.
+func runSteps(ctx context.Context, steps []Step, job *Job, maxParallel int) error {
+	if err := checkSteps(steps); err != nil {
+		return fmt.Errorf("invalid pipeline: %w", err)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	start := time.Now()
+	budget := pipelineBudget(steps, job)
+	budgetTimer := time.AfterFunc(budget, func() { cancel(errPipelineBudget) })
+	defer budgetTimer.Stop()
+	rescaled := false
+
+	index := make(map[string]int, len(steps))
+	waiting := make(map[string]int, len(steps)) // unfinished dependencies
+	dependents := make(map[string][]string)
+	var ready []int
+	for i, s := range steps {
+		index[s.Name()] = i
+		waiting[s.Name()] = len(s.Deps())
+		for _, d := range s.Deps() {
+			dependents[d] = append(dependents[d], s.Name())
+		}
+		if len(s.Deps()) == 0 {
+			ready = append(ready, i)
+		}
+	}
+	finish := func(name string) {
+		for _, d := range dependents[name] {
+			if waiting[d]--; waiting[d] == 0 {
+				ready = append(ready, index[d])
+			}
+		}
+		sort.Ints(ready)
+	}
+
+	done := make(chan stepOutcome)
+	running := 0
+	var failure error
+	for {
+		for failure == nil && len(ready) > 0 && running < maxParallel {
+			s := steps[ready[0]]
+			ready = ready[1:]
+			if IsOptionalStep(s.Name()) && !job.Options.stepEnabled(s.Name()) {
+				skipStep(s.Name(), job)
+				finish(s.Name())
+				continue
+			}
+			running++
+			go func() {
+				done <- stepOutcome{step: s, err: executeStep(ctx, s, job)}
+			}()
+		}
+		if running == 0 {
+			if failure != nil && errors.Is(context.Cause(ctx), errPipelineBudget) {
+				return joberrors.Transient(joberrors.CodeTimeout, fmt.Errorf("%w (%s): %w", errPipelineBudget, budget.Round(time.Second), failure))
+			}
+			return failure
+		}
+
+		out := <-done
+		running--
+		if out.err != nil {
+			if !out.step.Critical() && errors.Is(context.Cause(ctx), errPipelineBudget) {
+				timeOutStep(out.step.Name(), job)
+			} else if !out.step.Critical() {
+				log.Warn().Err(out.err).Str("step", out.step.Name()).Msg("Non-critical step failed, skipping")
+			} else if failure == nil {
+				failure = fmt.Errorf("%s failed: %w", out.step.Name(), out.err)
+				cancel(nil)
+			}
+		}
+		finish(out.step.Name())
+
+		if !rescaled && job.Metadata() != nil {
+			rescaled = true
+			budget = pipelineBudget(steps, job)
+			if budgetTimer.Stop() {
+				budgetTimer.Reset(time.Until(start.Add(budget)))
+			}
+			log.Info().Dur("budget", budget).Msg("Pipeline budget set from the video metadata")
+			if job.Options.OnBudget != nil {
+				job.Options.OnBudget(budget)
+			}
+		}
+	}
+}
+
+// executeStep runs s through runStep and records its artifacts in job on
+// success. Checkpointed steps are resumed from a checkpoint instead when one
+// validates, and checkpointed after they ran.
+func executeStep(ctx context.Context, s Step, job *Job) error {
+	if resumeStep(ctx, s, job) {
+		return nil
+	}
+	timeout := job.stepTimeout(s)
+	log.Info().Str("step", s.Name()).Dur("timeout", timeout).Msg("Running step")
+	err := runStep(ctx, s.Name(), timeout, func(stepCtx context.Context) error {
+		artifacts, err := s.Run(stepCtx, job)
+		if err != nil {
+			return err
+		}
+		job.addArtifacts(artifacts)
+		return nil
+	})
+	if err == nil {
+		checkpointStep(ctx, s, job)
+	}
+	return err
+}
+
+// skipStep records a step disabled for the job, in job and in the step metrics.
+func skipStep(name string, job *Job) {
+	log.Info().Str("step", name).Msg("Step disabled for this job, skipping")
+	metrics.ProcessingStepsTotal.WithLabelValues(name, "skipped").Inc()
+	job.mu.Lock()
+	job.skipped = append(job.skipped, name)
+	job.mu.Unlock()
+}
+
+// timeOutStep records a non-critical step cancelled by the pipeline budget in job.
+// Its step metric was counted with the timeout status by runStep.
+func timeOutStep(name string, job *Job) {
+	log.Warn().Str("step", name).Msg("Non-critical step cancelled by the pipeline budget, skipping")
+	job.mu.Lock()
+	job.timedOut = append(job.timedOut, name)
+	job.mu.Unlock()
+}
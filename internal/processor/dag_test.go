@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder logs the order in which fake steps start.
+type recorder struct {
+	mu      sync.Mutex
+	started []string
+}
+
+func (r *recorder) step(name string, deps []string, critical bool, fn RunFunc) Step {
+	return NewStep(name, deps, critical, StepBudget{Timeout: time.Second}, func(ctx context.Context, job *Job) (Artifacts, error) {
+		r.mu.Lock()
+		r.started = append(r.started, name)
+		r.mu.Unlock()
+		if fn == nil {
+			return Artifacts{name: "/tmp/" + name}, nil
+		}
+		return fn(ctx, job)
+	})
+}
+
+func TestRunSteps_FollowsDependencies(t *testing.T) {
+	r := &recorder{}
+	steps := []Step{
+		r.step("late", []string{"b"}, false, nil),
+		r.step("b", []string{"a"}, true, nil),
+		r.step("a", nil, true, nil),
+		r.step("c", []string{"a"}, false, nil),
+	}
+	job := &Job{}
+	if err := runSteps(context.Background(), steps, job, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	// Sequential: of the ready steps, the one declared first starts first.
+	if got := strings.Join(r.started, ","); got != "a,b,late,c" {
+		t.Errorf("expected order a,b,late,c, got %s", got)
+	}
+	if job.Artifact("late") == "" || job.Artifact("c") == "" {
+		t.Errorf("expected artifacts of every step, got %v", job.Artifacts())
+	}
+}
+
+func TestRunSteps_BoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var steps []Step
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		steps = append(steps, NewStep(name, nil, false, StepBudget{Timeout: time.Second}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil, nil
+		}))
+	}
+	if err := runSteps(context.Background(), steps, &Job{}, 2); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if peak != 2 {
+		t.Errorf("expected 2 steps at a time, got a peak of %d", peak)
+	}
+}
+
+func TestRunSteps_CriticalFailureStopsThePipeline(t *testing.T) {
+	r := &recorder{}
+	boom := errors.New("boom")
+	var interrupted bool
+	steps := []Step{
+		r.step("slow", nil, false, func(ctx context.Context, job *Job) (Artifacts, error) {
+			select {
+			case <-ctx.Done():
+				interrupted = true
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+				return nil, nil
+			}
+		}),
+		r.step("critical", nil, true, func(ctx context.Context, job *Job) (Artifacts, error) {
+			return nil, boom
+		}),
+		r.step("after", []string{"critical"}, false, nil),
+	}
+	err := runSteps(context.Background(), steps, &Job{}, 2)
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "critical failed") {
+		t.Fatalf("expected the critical step error, got %v", err)
+	}
+	if !interrupted {
+		t.Error("expected the running step to be cancelled")
+	}
+	for _, name := range r.started {
+		if name == "after" {
+			t.Error("expected no step to start after a critical failure")
+		}
+	}
+}
+
+func TestRunSteps_NonCriticalFailureKeepsGoing(t *testing.T) {
+	r := &recorder{}
+	steps := []Step{
+		r.step("soft", nil, false, func(ctx context.Context, job *Job) (Artifacts, error) {
+			return nil, errors.New("soft failure")
+		}),
+		r.step("next", []string{"soft"}, true, func(ctx context.Context, job *Job) (Artifacts, error) {
+			if _, err := job.Require("soft"); err == nil {
+				t.Error("expected the artifact of a failed step to be missing")
+			}
+			return nil, nil
+		}),
+	}
+	if err := runSteps(context.Background(), steps, &Job{}, 1); err != nil {
+		t.Fatalf("expected non-critical failures to be swallowed, got %v", err)
+	}
+	if len(r.started) != 2 {
+		t.Errorf("expected both steps to run, got %v", r.started)
+	}
+}
+
+func TestRunSteps_SkipsDisabledOptionalSteps(t *testing.T) {
+	r := &recorder{}
+	steps := []Step{
+		r.step(StepTranscode, nil, true, nil),
+		r.step(StepThumbnails, []string{StepTranscode}, false, nil),
+		r.step(StepAudio, []string{StepTranscode}, false, nil),
+		r.step("after-thumbnails", []string{StepThumbnails}, true, nil),
+	}
+	job := &Job{Options: Options{Steps: []string{StepAudio}}}
+	if err := runSteps(context.Background(), steps, job, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if got := strings.Join(r.started, ","); got != "transcode,audio,after-thumbnails" {
+		t.Errorf("expected thumbnails to be skipped without blocking its dependents, got %s", got)
+	}
+	if got := job.SkippedSteps(); len(got) != 1 || got[0] != StepThumbnails {
+		t.Errorf("expected thumbnails to be recorded as skipped, got %v", got)
+	}
+}
+
+func TestCheckSteps(t *testing.T) {
+	step := func(name string, deps ...string) Step {
+		return NewStep(name, deps, false, StepBudget{Timeout: time.Second}, nil)
+	}
+	cases := []struct {
+		name  string
+		steps []Step
+		want  string
+	}{
+		{"duplicate", []Step{step("a"), step("a")}, "defined twice"},
+		{"unknown dependency", []Step{step("a", "missing")}, "unknown step"},
+		{"cycle", []Step{step("a", "c"), step("b", "a"), step("c", "b")}, "cycle"},
+	}
+	for _, c := range cases {
+		err := checkSteps(c.steps)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+	if err := checkSteps(builtinSteps()); err != nil {
+		t.Errorf("expected the built-in pipeline to be valid, got %v", err)
+	}
+}
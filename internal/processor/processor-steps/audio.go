@@ -3,12 +3,11 @@ package processor_steps
 import (
 	"context"
 	"fmt"
-	"os/exec"
 )
 
 // ExtractAudio extracts the audio track from the video in MP3 format.
 func ExtractAudio(ctx context.Context, inputPath, outputPath string) error {
-	cmd := exec.CommandContext(ctx, "ffmpeg",
+	output, err := runFFmpeg(ctx,
 		"-i", inputPath,
 		"-vn",
 		"-acodec", "libmp3lame",
@@ -16,8 +15,6 @@ func ExtractAudio(ctx context.Context, inputPath, outputPath string) error {
 		"-y",
 		outputPath,
 	)
-
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("audio extraction failed: %w, output: %s", err, string(output))
 	}
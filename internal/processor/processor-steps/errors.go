@@ -0,0 +1,38 @@
+package processor_steps
+
+import (
+	"context"
+	"strings"
+
+	"video-processor/internal/joberrors"
+)
+
+// permanentFFmpegOutputs maps FFmpeg/ffprobe messages that no retry can fix to a failure code.
+var permanentFFmpegOutputs = []struct {
+	marker string
+	code   joberrors.Code
+}{
+	{"Invalid data found when processing input", joberrors.CodeInvalidInput},
+	{"moov atom not found", joberrors.CodeInvalidInput},
+	{"does not contain any stream", joberrors.CodeInvalidInput},
+	{"Unknown decoder", joberrors.CodeUnsupportedCodec},
+	{"Decoder not found", joberrors.CodeUnsupportedCodec},
+	{"unsupported codec", joberrors.CodeUnsupportedCodec},
+	{"Could not find codec parameters", joberrors.CodeUnsupportedCodec},
+}
+
+// classifyFFmpegFailure tags err (a failed FFmpeg/ffprobe run that printed output)
+// as permanent when the output shows a broken or unsupported input, and as a
+// transient timeout when ctx expired. Anything else is returned unclassified.
+func classifyFFmpegFailure(ctx context.Context, err error, output []byte) error {
+	if ctx.Err() != nil {
+		return joberrors.Transient(joberrors.CodeTimeout, err)
+	}
+	out := strings.ToLower(string(output))
+	for _, p := range permanentFFmpegOutputs {
+		if strings.Contains(out, strings.ToLower(p.marker)) {
+			return joberrors.Permanent(p.code, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package processor_steps
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"video-processor/internal/joberrors"
+)
+
+func TestClassifyFFmpegFailure(t *testing.T) {
+	base := errors.New("exit status 1")
+	cases := []struct {
+		name      string
+		output    string
+		permanent bool
+		code      joberrors.Code
+	}{
+		{"corrupt input", "input.mp4: Invalid data found when processing input", true, joberrors.CodeInvalidInput},
+		{"truncated mp4", "[mov,mp4] moov atom not found", true, joberrors.CodeInvalidInput},
+		{"unknown codec", "Stream #0:0: Video: none, Unknown decoder 'xyz'", true, joberrors.CodeUnsupportedCodec},
+		{"other failure", "Cannot allocate memory", false, joberrors.CodeUnknown},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := classifyFFmpegFailure(context.Background(), base, []byte(c.output))
+			if joberrors.IsPermanent(err) != c.permanent {
+				t.Errorf("expected permanent=%v, got %v", c.permanent, joberrors.IsPermanent(err))
+			}
+			if code := joberrors.CodeOf(err); code != c.code {
+				t.Errorf("expected code %s, got %s", c.code, code)
+			}
+		})
+	}
+}
+
+func TestClassifyFFmpegFailure_Timeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := classifyFFmpegFailure(ctx, errors.New("signal: killed"), []byte("Invalid data found when processing input"))
+	if joberrors.IsPermanent(err) {
+		t.Error("expected an interrupted command to be retried")
+	}
+	if code := joberrors.CodeOf(err); code != joberrors.CodeTimeout {
+		t.Errorf("expected code %s, got %s", joberrors.CodeTimeout, code)
+	}
+}
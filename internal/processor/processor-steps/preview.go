@@ -8,8 +8,15 @@ import (
 	"strings"
 )
 
-// GeneratePreview generates a low-quality preview of the video (first 30 seconds or 10% of the video).
+// GeneratePreview generates a low-quality preview of the video (first 30 seconds)
+// with the settings of the default profile.
 func GeneratePreview(ctx context.Context, inputPath, outputPath string) error {
+	profile, _ := LookupEncodingProfile(DefaultEncodingProfile)
+	return GeneratePreviewWithConfig(ctx, inputPath, outputPath, profile.Preview)
+}
+
+// GeneratePreviewWithConfig generates a preview of the first cfg.MaxSeconds of the video.
+func GeneratePreviewWithConfig(ctx context.Context, inputPath, outputPath string, cfg PreviewConfig) error {
 	durationCmd := exec.CommandContext(ctx, "ffprobe",
 		"-v", "error",
 		"-show_entries", "format=duration",
@@ -28,23 +35,22 @@ func GeneratePreview(ctx context.Context, inputPath, outputPath string) error {
 	}
 
 	previewDuration := duration
-	if previewDuration > 30 {
-		previewDuration = 30
+	if maxSeconds := float64(cfg.MaxSeconds); previewDuration > maxSeconds {
+		previewDuration = maxSeconds
 	}
 
-	cmd := exec.CommandContext(ctx, "ffmpeg",
+	// Progress is measured against the preview length, not the full video.
+	output, err := runFFmpeg(withProgressDuration(ctx, previewDuration),
 		"-i", inputPath,
 		"-t", strconv.FormatFloat(previewDuration, 'f', 0, 64),
-		"-vf", "scale=640:-2",
-		"-b:v", "500k",
+		"-vf", fmt.Sprintf("scale=%d:-2", cfg.Width),
+		"-b:v", cfg.VideoBitrate,
 		"-c:a", "aac",
-		"-b:a", "64k",
+		"-b:a", cfg.AudioBitrate,
 		"-preset", "veryfast",
 		"-y",
 		outputPath,
 	)
-
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("preview generation failed: %w, output: %s", err, string(output))
 	}
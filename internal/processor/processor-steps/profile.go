@@ -0,0 +1,316 @@
+package processor_steps
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEncodingProfile is used when a job does not name a profile.
+const DefaultEncodingProfile = "default"
+
+// Video codecs of the transcoded MP4. HLS renditions are always H.264 (MPEG-TS segments).
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecHEVC = "hevc"
+)
+
+// EncodingProfile holds the settings used by TranscodeVideo, SegmentForStreaming
+// and GeneratePreview. Profiles are built in (encodingProfiles) or loaded from
+// a file by LoadEncodingProfiles; zero fields take the default profile's value.
+type EncodingProfile struct {
+	Name string `yaml:"-" json:"name"`
+	// Codec is the MP4 video codec: h264 (libx264 / h264_nvenc) or hevc (libx265 / hevc_nvenc).
+	Codec string `yaml:"codec" json:"codec"`
+	// CRF is the constant rate factor; also used as the NVENC -cq value. Ignored when VideoBitrate is set.
+	CRF int `yaml:"crf" json:"crf"`
+	// VideoBitrate switches the MP4 from constant quality to a target bitrate (e.g. "4M").
+	VideoBitrate string `yaml:"video_bitrate" json:"video_bitrate,omitempty"`
+	// Preset is the libx264/libx265 preset (NVENC uses its own p1–p7 preset).
+	Preset       string `yaml:"preset" json:"preset"`
+	AudioBitrate string `yaml:"audio_bitrate" json:"audio_bitrate"`
+	// AudioChannels downmixes the audio (e.g. 2 for stereo); 0 keeps the source layout.
+	AudioChannels int           `yaml:"audio_channels" json:"audio_channels,omitempty"`
+	HLS           HLSProfile    `yaml:"hls" json:"hls"`
+	Preview       PreviewConfig `yaml:"preview" json:"preview"`
+}
+
+// HLSProfile is the adaptive streaming ladder of a profile.
+type HLSProfile struct {
+	// SegmentSeconds is the target segment length (-hls_time).
+	SegmentSeconds int `yaml:"segment_seconds" json:"segment_seconds"`
+	// Ladder lists the renditions in ascending height. Only rungs no taller than the
+	// source are generated (at least the first one).
+	Ladder []HLSRung `yaml:"ladder" json:"ladder"`
+}
+
+// HLSRung is one rendition of the HLS ladder.
+type HLSRung struct {
+	// Name is the rendition directory under hls/<videoID>/ (e.g. "720p").
+	Name         string `yaml:"name" json:"name"`
+	Height       int    `yaml:"height" json:"height"`
+	VideoBitrate string `yaml:"video_bitrate" json:"video_bitrate"`
+	AudioBitrate string `yaml:"audio_bitrate" json:"audio_bitrate"`
+	// Bandwidth (bits/s) is advertised in master.m3u8; 0 derives it from the bitrates.
+	Bandwidth int `yaml:"bandwidth" json:"bandwidth"`
+}
+
+// PreviewConfig holds the settings of the short preview clip.
+type PreviewConfig struct {
+	// MaxSeconds caps the preview length (the preview is the start of the video).
+	MaxSeconds   int    `yaml:"max_seconds" json:"max_seconds"`
+	Width        int    `yaml:"width" json:"width"`
+	VideoBitrate string `yaml:"video_bitrate" json:"video_bitrate"`
+	AudioBitrate string `yaml:"audio_bitrate" json:"audio_bitrate"`
+}
+
+// defaultHLSLadder is the built-in ladder, 240p to 1080p.
+var defaultHLSLadder = []HLSRung{
+	{Name: "240p", Height: 240, VideoBitrate: "400k", AudioBitrate: "64k", Bandwidth: 464000},
+	{Name: "360p", Height: 360, VideoBitrate: "800k", AudioBitrate: "96k", Bandwidth: 896000},
+	{Name: "480p", Height: 480, VideoBitrate: "1400k", AudioBitrate: "128k", Bandwidth: 1528000},
+	{Name: "720p", Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k", Bandwidth: 2928000},
+	{Name: "1080p", Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k", Bandwidth: 5192000},
+}
+
+// defaultProfile holds the values zero fields of other profiles fall back to.
+var defaultProfile = EncodingProfile{
+	Name:         DefaultEncodingProfile,
+	Codec:        VideoCodecH264,
+	CRF:          23,
+	Preset:       "fast",
+	AudioBitrate: "128k",
+	HLS:          HLSProfile{SegmentSeconds: 6, Ladder: defaultHLSLadder},
+	Preview:      PreviewConfig{MaxSeconds: 30, Width: 640, VideoBitrate: "500k", AudioBitrate: "64k"},
+}
+
+var (
+	profilesMu sync.RWMutex
+	// encodingProfiles lists the profiles selectable per job: the built-in ones,
+	// plus or overridden by those of ENCODING_PROFILES_FILE.
+	encodingProfiles = builtinEncodingProfiles()
+)
+
+func builtinEncodingProfiles() map[string]EncodingProfile {
+	profiles := map[string]EncodingProfile{}
+	for _, p := range []EncodingProfile{
+		defaultProfile,
+		{Name: "high", CRF: 20, Preset: "medium", AudioBitrate: "192k"},
+		{Name: "fast", CRF: 26, Preset: "veryfast", AudioBitrate: "96k"},
+	} {
+		profiles[p.Name] = p.withDefaults()
+	}
+	return profiles
+}
+
+// LookupEncodingProfile returns the profile with the given name. An empty name
+// returns the default profile.
+func LookupEncodingProfile(name string) (EncodingProfile, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultEncodingProfile
+	}
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := encodingProfiles[name]
+	return p, ok
+}
+
+// EncodingProfileNames returns the names of the selectable profiles, sorted.
+func EncodingProfileNames() []string {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	names := make([]string, 0, len(encodingProfiles))
+	for name := range encodingProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profilesFile is the layout of ENCODING_PROFILES_FILE (YAML, or JSON as a subset of it).
+type profilesFile struct {
+	Profiles map[string]EncodingProfile `yaml:"profiles"`
+}
+
+// LoadEncodingProfiles reads the profiles of the YAML or JSON file at path and
+// makes them selectable, replacing the built-in profiles of the same name.
+// Every profile is validated; on error nothing changes. Call it at startup.
+func LoadEncodingProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read encoding profiles: %w", err)
+	}
+	loaded, err := parseEncodingProfiles(data)
+	if err != nil {
+		return fmt.Errorf("invalid encoding profiles %s: %w", path, err)
+	}
+
+	profiles := builtinEncodingProfiles()
+	for name, p := range loaded {
+		profiles[name] = p
+	}
+	profilesMu.Lock()
+	encodingProfiles = profiles
+	profilesMu.Unlock()
+	return nil
+}
+
+// parseEncodingProfiles decodes and validates the profiles in data, with defaults applied.
+func parseEncodingProfiles(data []byte) (map[string]EncodingProfile, error) {
+	var file profilesFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, errors.New("no profiles defined")
+	}
+
+	profiles := make(map[string]EncodingProfile, len(file.Profiles))
+	for name, p := range file.Profiles {
+		p.Name = strings.ToLower(strings.TrimSpace(name))
+		if !namePattern.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid profile name %q", name)
+		}
+		p = p.withDefaults()
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		profiles[p.Name] = p
+	}
+	return profiles, nil
+}
+
+// withDefaults fills the zero fields of p from the default profile.
+func (p EncodingProfile) withDefaults() EncodingProfile {
+	d := defaultProfile
+	if p.Codec == "" {
+		p.Codec = d.Codec
+	}
+	if p.CRF == 0 && p.VideoBitrate == "" {
+		p.CRF = d.CRF
+	}
+	if p.Preset == "" {
+		p.Preset = d.Preset
+	}
+	if p.AudioBitrate == "" {
+		p.AudioBitrate = d.AudioBitrate
+	}
+	if p.HLS.SegmentSeconds == 0 {
+		p.HLS.SegmentSeconds = d.HLS.SegmentSeconds
+	}
+	if len(p.HLS.Ladder) == 0 {
+		p.HLS.Ladder = d.HLS.Ladder
+	}
+	ladder := make([]HLSRung, len(p.HLS.Ladder))
+	for i, r := range p.HLS.Ladder {
+		if r.Bandwidth == 0 {
+			r.Bandwidth = bitrateBits(r.VideoBitrate) + bitrateBits(r.AudioBitrate)
+		}
+		ladder[i] = r
+	}
+	p.HLS.Ladder = ladder
+	if p.Preview.MaxSeconds == 0 {
+		p.Preview.MaxSeconds = d.Preview.MaxSeconds
+	}
+	if p.Preview.Width == 0 {
+		p.Preview.Width = d.Preview.Width
+	}
+	if p.Preview.VideoBitrate == "" {
+		p.Preview.VideoBitrate = d.Preview.VideoBitrate
+	}
+	if p.Preview.AudioBitrate == "" {
+		p.Preview.AudioBitrate = d.Preview.AudioBitrate
+	}
+	return p
+}
+
+var (
+	namePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	bitratePattern = regexp.MustCompile(`^[1-9][0-9]*[kM]?$`)
+	// x264Presets are the presets accepted by libx264 and libx265.
+	x264Presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+)
+
+// Validate checks that p (with defaults applied) yields valid FFmpeg arguments.
+func (p EncodingProfile) Validate() error {
+	if p.Codec != VideoCodecH264 && p.Codec != VideoCodecHEVC {
+		return fmt.Errorf("unsupported codec %q (allowed: %s, %s)", p.Codec, VideoCodecH264, VideoCodecHEVC)
+	}
+	if p.CRF < 0 || p.CRF > 51 {
+		return fmt.Errorf("crf %d out of range [0, 51]", p.CRF)
+	}
+	if p.VideoBitrate != "" && !bitratePattern.MatchString(p.VideoBitrate) {
+		return fmt.Errorf("invalid video_bitrate %q", p.VideoBitrate)
+	}
+	if !contains(x264Presets, p.Preset) {
+		return fmt.Errorf("unknown preset %q", p.Preset)
+	}
+	if !bitratePattern.MatchString(p.AudioBitrate) {
+		return fmt.Errorf("invalid audio_bitrate %q", p.AudioBitrate)
+	}
+	if p.AudioChannels < 0 || p.AudioChannels > 8 {
+		return fmt.Errorf("audio_channels %d out of range [0, 8]", p.AudioChannels)
+	}
+	if p.HLS.SegmentSeconds < 1 || p.HLS.SegmentSeconds > 60 {
+		return fmt.Errorf("hls.segment_seconds %d out of range [1, 60]", p.HLS.SegmentSeconds)
+	}
+	names := map[string]bool{}
+	for i, r := range p.HLS.Ladder {
+		switch {
+		case !namePattern.MatchString(r.Name):
+			return fmt.Errorf("hls.ladder[%d]: invalid name %q", i, r.Name)
+		case names[r.Name]:
+			return fmt.Errorf("hls.ladder[%d]: duplicate name %q", i, r.Name)
+		case r.Height <= 0 || r.Height%2 != 0:
+			return fmt.Errorf("hls.ladder[%d]: height must be positive and even, got %d", i, r.Height)
+		case i > 0 && r.Height <= p.HLS.Ladder[i-1].Height:
+			return fmt.Errorf("hls.ladder[%d]: heights must be ascending", i)
+		case !bitratePattern.MatchString(r.VideoBitrate) || !bitratePattern.MatchString(r.AudioBitrate):
+			return fmt.Errorf("hls.ladder[%d]: invalid bitrate", i)
+		}
+		names[r.Name] = true
+	}
+	if p.Preview.MaxSeconds < 1 || p.Preview.Width <= 0 || p.Preview.Width%2 != 0 {
+		return errors.New("preview: max_seconds must be positive and width positive and even")
+	}
+	if !bitratePattern.MatchString(p.Preview.VideoBitrate) || !bitratePattern.MatchString(p.Preview.AudioBitrate) {
+		return errors.New("preview: invalid bitrate")
+	}
+	return nil
+}
+
+// bitrateBits converts an FFmpeg bitrate ("400k", "5M", "128000") to bits/s; 0 if invalid.
+func bitrateBits(rate string) int {
+	mult := 1
+	switch {
+	case strings.HasSuffix(rate, "k"):
+		mult, rate = 1000, strings.TrimSuffix(rate, "k")
+	case strings.HasSuffix(rate, "M"):
+		mult, rate = 1000000, strings.TrimSuffix(rate, "M")
+	}
+	n, err := strconv.Atoi(rate)
+	if err != nil {
+		return 0
+	}
+	return n * mult
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package processor_steps
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupEncodingProfile(t *testing.T) {
+	p, ok := LookupEncodingProfile("")
+	if !ok || p.Name != DefaultEncodingProfile {
+		t.Errorf("empty name should return the default profile, got %+v (ok: %v)", p, ok)
+	}
+
+	p, ok = LookupEncodingProfile(" HIGH ")
+	if !ok || p.Name != "high" {
+		t.Errorf("lookup should be case-insensitive, got %+v (ok: %v)", p, ok)
+	}
+
+	if _, ok := LookupEncodingProfile("unknown"); ok {
+		t.Error("unknown profile should not be found")
+	}
+}
+
+func TestThumbnailConfig_WithDefaults(t *testing.T) {
+	got := ThumbnailConfig{Count: 3}.WithDefaults()
+	expected := ThumbnailConfig{Count: 3, Width: 320, Height: 180}
+	if got != expected {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestParseEncodingProfiles(t *testing.T) {
+	yamlData := `
+profiles:
+  Mobile:
+    crf: 28
+    audio_channels: 2
+    hls:
+      segment_seconds: 4
+      ladder:
+        - {name: 360p, height: 360, video_bitrate: 700k, audio_bitrate: 64k}
+        - {name: 720p, height: 720, video_bitrate: 2M, audio_bitrate: 96k, bandwidth: 2200000}
+`
+	profiles, err := parseEncodingProfiles([]byte(yamlData))
+	if err != nil {
+		t.Fatalf("parseEncodingProfiles: %v", err)
+	}
+	p, ok := profiles["mobile"]
+	if !ok {
+		t.Fatalf("expected the profile name to be lower-cased, got %v", profiles)
+	}
+	if p.Codec != VideoCodecH264 || p.Preset != "fast" || p.AudioBitrate != "128k" || p.Preview != defaultProfile.Preview {
+		t.Errorf("expected the default profile's values for unset fields, got %+v", p)
+	}
+	if p.CRF != 28 || p.AudioChannels != 2 || p.HLS.SegmentSeconds != 4 {
+		t.Errorf("expected the file's values, got %+v", p)
+	}
+	if got := p.HLS.Ladder[0].Bandwidth; got != 764000 {
+		t.Errorf("expected the bandwidth to be derived from the bitrates, got %d", got)
+	}
+	if got := p.HLS.Ladder[1].Bandwidth; got != 2200000 {
+		t.Errorf("expected an explicit bandwidth to be kept, got %d", got)
+	}
+
+	jsonData := `{"profiles": {"archive": {"codec": "hevc", "video_bitrate": "8M", "preset": "slow"}}}`
+	profiles, err = parseEncodingProfiles([]byte(jsonData))
+	if err != nil {
+		t.Fatalf("parseEncodingProfiles (JSON): %v", err)
+	}
+	if p := profiles["archive"]; p.Codec != VideoCodecHEVC || p.VideoBitrate != "8M" || p.CRF != 0 {
+		t.Errorf("expected a bitrate-driven hevc profile, got %+v", p)
+	}
+}
+
+func TestParseEncodingProfiles_Invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", `profiles: {}`, "no profiles"},
+		{"unknown field", `profiles: {a: {crff: 20}}`, "crff"},
+		{"bad name", `profiles: {"a b": {crf: 20}}`, "invalid profile name"},
+		{"codec", `profiles: {a: {codec: vp9}}`, "unsupported codec"},
+		{"crf", `profiles: {a: {crf: 60}}`, "crf"},
+		{"preset", `profiles: {a: {preset: turbo}}`, "preset"},
+		{"bitrate", `profiles: {a: {audio_bitrate: 128kbps}}`, "audio_bitrate"},
+		{"segment", `profiles: {a: {hls: {segment_seconds: 90}}}`, "segment_seconds"},
+		{"odd height", `profiles: {a: {hls: {ladder: [{name: x, height: 361, video_bitrate: 1M, audio_bitrate: 64k}]}}}`, "even"},
+		{"descending", `profiles: {a: {hls: {ladder: [
+			{name: hi, height: 720, video_bitrate: 2M, audio_bitrate: 96k},
+			{name: lo, height: 360, video_bitrate: 1M, audio_bitrate: 64k}]}}}`, "ascending"},
+	}
+	for _, c := range cases {
+		_, err := parseEncodingProfiles([]byte(c.data))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestLoadEncodingProfiles(t *testing.T) {
+	t.Cleanup(func() {
+		profilesMu.Lock()
+		encodingProfiles = builtinEncodingProfiles()
+		profilesMu.Unlock()
+	})
+
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	data := "profiles:\n  high: {crf: 18, preset: slow}\n  mobile: {crf: 28}\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadEncodingProfiles(path); err != nil {
+		t.Fatalf("LoadEncodingProfiles: %v", err)
+	}
+	if got := EncodingProfileNames(); !reflect.DeepEqual(got, []string{"default", "fast", "high", "mobile"}) {
+		t.Errorf("expected the file's profiles merged over the built-ins, got %v", got)
+	}
+	if p, _ := LookupEncodingProfile("high"); p.CRF != 18 || p.Preset != "slow" {
+		t.Errorf("expected the file to override the built-in high profile, got %+v", p)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles: {low: {crf: 99}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadEncodingProfiles(path); err == nil {
+		t.Fatal("expected an invalid file to be rejected")
+	}
+	if _, ok := LookupEncodingProfile("mobile"); !ok {
+		t.Error("expected a rejected file to leave the profiles unchanged")
+	}
+}
+
+func TestVideoArgs(t *testing.T) {
+	def, _ := LookupEncodingProfile(DefaultEncodingProfile)
+	if got, want := cpuVideoArgs(def), []string{"-c:v", "libx264", "-preset", "fast", "-crf", "23"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default profile: expected %v, got %v", want, got)
+	}
+
+	hevc := EncodingProfile{Codec: VideoCodecHEVC, VideoBitrate: "8M", Preset: "slow"}.withDefaults()
+	if got, want := cpuVideoArgs(hevc), []string{"-c:v", "libx265", "-preset", "slow", "-b:v", "8M", "-tag:v", "hvc1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hevc profile: expected %v, got %v", want, got)
+	}
+	if got, want := nvencVideoArgs(hevc, "p5"), []string{"-c:v", "hevc_nvenc", "-preset", "p5", "-tune", "hq", "-rc", "vbr", "-b:v", "8M", "-tag:v", "hvc1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hevc nvenc: expected %v, got %v", want, got)
+	}
+}
+
+func TestEncodingProfilesExample(t *testing.T) {
+	data, err := os.ReadFile("../../../encoding-profiles.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseEncodingProfiles(data); err != nil {
+		t.Errorf("expected the example file to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package processor_steps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc receives the completion of the running step as a fraction in [0, 1].
+type ProgressFunc func(fraction float64)
+
+type progressKey struct{}
+
+// progressReporter converts FFmpeg out_time into a fraction of the step.
+type progressReporter struct {
+	// duration is the length in seconds of the media written by the command.
+	duration float64
+	// offset and scale map the command's own fraction into the step's range,
+	// for steps that run several FFmpeg commands one after another.
+	offset, scale float64
+	report        ProgressFunc
+}
+
+// WithProgress returns a context whose FFmpeg commands run with -progress and
+// report out_time against duration (seconds) to fn. A non-positive duration or
+// nil fn disables progress reporting.
+func WithProgress(ctx context.Context, duration float64, fn ProgressFunc) context.Context {
+	if duration <= 0 || fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, &progressReporter{duration: duration, scale: 1, report: fn})
+}
+
+func progressFrom(ctx context.Context) *progressReporter {
+	p, _ := ctx.Value(progressKey{}).(*progressReporter)
+	return p
+}
+
+// withProgressDuration is used by commands that only write part of the input (e.g. preview with -t).
+func withProgressDuration(ctx context.Context, duration float64) context.Context {
+	p := progressFrom(ctx)
+	if p == nil || duration <= 0 {
+		return ctx
+	}
+	cp := *p
+	cp.duration = duration
+	return context.WithValue(ctx, progressKey{}, &cp)
+}
+
+// withProgressSlice maps the progress of command i (0-based) of n into [i/n, (i+1)/n].
+func withProgressSlice(ctx context.Context, i, n int) context.Context {
+	p := progressFrom(ctx)
+	if p == nil || n <= 1 {
+		return ctx
+	}
+	cp := *p
+	cp.offset = p.offset + p.scale*float64(i)/float64(n)
+	cp.scale = p.scale / float64(n)
+	return context.WithValue(ctx, progressKey{}, &cp)
+}
+
+// reportProgress reports fraction directly, for steps that track progress themselves.
+func reportProgress(ctx context.Context, fraction float64) {
+	if p := progressFrom(ctx); p != nil {
+		p.report(p.offset + p.scale*clampFraction(fraction))
+	}
+}
+
+func (p *progressReporter) reportOutTime(seconds float64) {
+	p.report(p.offset + p.scale*clampFraction(seconds/p.duration))
+}
+
+func clampFraction(f float64) float64 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// runFFmpeg runs ffmpeg with args and returns its output like CombinedOutput.
+// When ctx carries a progress reporter, -progress pipe:1 is added and parsed;
+// the returned output is then stderr only (FFmpeg logs go to stderr anyway).
+func runFFmpeg(ctx context.Context, args ...string) ([]byte, error) {
+	p := progressFrom(ctx)
+	if p == nil {
+		return exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	parseProgress(stdout, p.reportOutTime)
+	err = cmd.Wait()
+	return stderr.Bytes(), err
+}
+
+// parseProgress reads FFmpeg -progress key=value output until EOF and calls fn
+// with each out_time in seconds.
+func parseProgress(r io.Reader, fn func(seconds float64)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if seconds, ok := parseProgressLine(scanner.Text()); ok {
+			fn(seconds)
+		}
+	}
+	// Drain so FFmpeg never blocks on a full pipe if the scanner stopped early.
+	io.Copy(io.Discard, r)
+}
+
+// parseProgressLine extracts the output position from an out_time_us line.
+// out_time_ms is also in microseconds (a long-standing FFmpeg quirk), and
+// out_time carries the same value as HH:MM:SS.micro, so only one key is used.
+func parseProgressLine(line string) (float64, bool) {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok || key != "out_time_us" {
+		return 0, false
+	}
+	us, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || us < 0 {
+		return 0, false // "N/A" before the first frame
+	}
+	return float64(us) / 1e6, true
+}
@@ -0,0 +1,85 @@
+package processor_steps
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want float64
+		ok   bool
+	}{
+		{"out_time_us=2500000", 2.5, true},
+		{"out_time_us=N/A", 0, false},
+		{"out_time_ms=2500000", 0, false},
+		{"out_time=00:00:02.500000", 0, false},
+		{"progress=continue", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		got, ok := parseProgressLine(c.line)
+		if ok != c.ok || got != c.want {
+			t.Errorf("parseProgressLine(%q) = (%v, %v), expected (%v, %v)", c.line, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	input := "frame=10\nout_time_us=1000000\nprogress=continue\nframe=20\nout_time_us=2000000\nprogress=end\n"
+	var got []float64
+	parseProgress(strings.NewReader(input), func(seconds float64) { got = append(got, seconds) })
+
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("expected [1 2], got %v", got)
+	}
+}
+
+func TestProgressReporter_Slices(t *testing.T) {
+	var last float64
+	ctx := WithProgress(context.Background(), 10, func(f float64) { last = f })
+
+	progressFrom(ctx).reportOutTime(5)
+	if last != 0.5 {
+		t.Errorf("expected 0.5, got %v", last)
+	}
+
+	second := withProgressSlice(ctx, 1, 2)
+	progressFrom(second).reportOutTime(5)
+	if math.Abs(last-0.75) > 1e-9 {
+		t.Errorf("expected 0.75 for half of the second slice, got %v", last)
+	}
+
+	preview := withProgressDuration(ctx, 2)
+	progressFrom(preview).reportOutTime(4)
+	if last != 1 {
+		t.Errorf("expected fraction to be clamped at 1, got %v", last)
+	}
+}
+
+func TestWithProgress_Disabled(t *testing.T) {
+	if progressFrom(WithProgress(context.Background(), 0, func(float64) {})) != nil {
+		t.Error("expected no reporter without a duration")
+	}
+	if progressFrom(WithProgress(context.Background(), 10, nil)) != nil {
+		t.Error("expected no reporter without a callback")
+	}
+}
+
+func TestTranscodeVideo_ReportsProgress(t *testing.T) {
+	inputPath := GenerateTestVideo(t, 5)
+	outputPath := t.TempDir() + "/output.mp4"
+
+	var last float64
+	ctx := WithProgress(context.Background(), 5, func(f float64) { last = f })
+	if err := TranscodeVideo(ctx, inputPath, outputPath, VideoEncoderCPU, ""); err != nil {
+		t.Fatalf("TranscodeVideo() failed: %v", err)
+	}
+	if last < 0.9 {
+		t.Errorf("expected progress near 1 at the end of transcoding, got %v", last)
+	}
+}
@@ -12,25 +12,6 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// hlsVariant defines a quality variant for adaptive streaming.
-type hlsVariant struct {
-	Name         string
-	Height       int
-	VideoBitrate string
-	AudioBitrate string
-	Bandwidth    int // bits/s for EXT-X-STREAM-INF
-}
-
-// hlsVariants lists the supported resolutions in ascending order.
-// Only variants with Height <= original video height are generated.
-var hlsVariants = []hlsVariant{
-	{"240p", 240, "400k", "64k", 464000},
-	{"360p", 360, "800k", "96k", 896000},
-	{"480p", 480, "1400k", "128k", 1528000},
-	{"720p", 720, "2800k", "128k", 2928000},
-	{"1080p", 1080, "5000k", "192k", 5192000},
-}
-
 // HLSOptions controls adaptive HLS generation behavior.
 type HLSOptions struct {
 	SingleCommand bool
@@ -38,6 +19,9 @@ type HLSOptions struct {
 	// VideoEncoder is VideoEncoderCPU or VideoEncoderNVENC (empty defaults to CPU).
 	VideoEncoder string
 	NVENCPreset  string
+	// Profile provides the ladder, segment length and encoder settings; a zero
+	// Profile uses the default encoding profile.
+	Profile EncodingProfile
 }
 
 // SegmentForStreaming generates adaptive HLS segments for multiple resolutions.
@@ -57,6 +41,9 @@ func SegmentForStreamingWithOptions(ctx context.Context, inputPath, outputDir st
 		encoder = VideoEncoderCPU
 	}
 	preset := NormalizeNVENCPreset(opts.NVENCPreset)
+	if opts.Profile.Name == "" {
+		opts.Profile, _ = LookupEncodingProfile(DefaultEncodingProfile)
+	}
 
 	err := segmentForStreamingBody(ctx, inputPath, outputDir, opts, encoder, preset)
 	if err != nil && encoder == VideoEncoderNVENC {
@@ -73,18 +60,19 @@ func segmentForStreamingBody(ctx context.Context, inputPath, outputDir string, o
 
 	sourceHeight := probeSourceHeight(ctx, inputPath)
 
-	var selected []hlsVariant
-	for _, v := range hlsVariants {
+	ladder := opts.Profile.HLS.Ladder
+	var selected []HLSRung
+	for _, v := range ladder {
 		if sourceHeight == 0 || v.Height <= sourceHeight {
 			selected = append(selected, v)
 		}
 	}
 	if len(selected) == 0 {
-		selected = hlsVariants[:1]
+		selected = ladder[:1]
 	}
 
 	if opts.SingleCommand {
-		err := segmentForStreamingSingleCommand(ctx, inputPath, outputDir, selected, encoder, nvencPreset)
+		err := segmentForStreamingSingleCommand(ctx, inputPath, outputDir, selected, opts.Profile, encoder, nvencPreset)
 		if err == nil {
 			return nil
 		}
@@ -94,16 +82,16 @@ func segmentForStreamingBody(ctx context.Context, inputPath, outputDir string, o
 		log.Warn().Err(err).Msg("Single-command HLS failed, falling back to sequential mode")
 	}
 
-	return segmentForStreamingSequential(ctx, inputPath, outputDir, selected, encoder, nvencPreset)
+	return segmentForStreamingSequential(ctx, inputPath, outputDir, selected, opts.Profile, encoder, nvencPreset)
 }
 
-func segmentForStreamingSequential(ctx context.Context, inputPath, outputDir string, selected []hlsVariant, encoder, nvencPreset string) error {
-	for _, v := range selected {
+func segmentForStreamingSequential(ctx context.Context, inputPath, outputDir string, selected []HLSRung, profile EncodingProfile, encoder, nvencPreset string) error {
+	for i, v := range selected {
 		varDir := filepath.Join(outputDir, v.Name)
 		if err := os.MkdirAll(varDir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", v.Name, err)
 		}
-		if err := transcodeHLSVariant(ctx, inputPath, varDir, v, encoder, nvencPreset); err != nil {
+		if err := transcodeHLSVariant(withProgressSlice(ctx, i, len(selected)), inputPath, varDir, v, profile, encoder, nvencPreset); err != nil {
 			return err
 		}
 	}
@@ -111,7 +99,7 @@ func segmentForStreamingSequential(ctx context.Context, inputPath, outputDir str
 	return writeMasterPlaylist(outputDir, selected)
 }
 
-func segmentForStreamingSingleCommand(ctx context.Context, inputPath, outputDir string, selected []hlsVariant, encoder, nvencPreset string) error {
+func segmentForStreamingSingleCommand(ctx context.Context, inputPath, outputDir string, selected []HLSRung, profile EncodingProfile, encoder, nvencPreset string) error {
 	for _, v := range selected {
 		if err := os.MkdirAll(filepath.Join(outputDir, v.Name), 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", v.Name, err)
@@ -140,13 +128,16 @@ func segmentForStreamingSingleCommand(ctx context.Context, inputPath, outputDir
 			args = append(args, "-map", "0:a:0?")
 		}
 
-		args = appendHLSSingleCommandVideoArgs(args, i, v, encoder, nvencPreset)
+		args = appendHLSSingleCommandVideoArgs(args, i, v, profile, encoder, nvencPreset)
 
 		if hasAudio {
 			args = append(args,
 				"-c:a:"+strconv.Itoa(i), "aac",
 				"-b:a:"+strconv.Itoa(i), v.AudioBitrate,
 			)
+			if profile.AudioChannels > 0 {
+				args = append(args, "-ac:a:"+strconv.Itoa(i), strconv.Itoa(profile.AudioChannels))
+			}
 			varStreamParts = append(varStreamParts, fmt.Sprintf("v:%d,a:%d,name:%s", i, i, v.Name))
 		} else {
 			varStreamParts = append(varStreamParts, fmt.Sprintf("v:%d,name:%s", i, v.Name))
@@ -155,7 +146,7 @@ func segmentForStreamingSingleCommand(ctx context.Context, inputPath, outputDir
 
 	args = append(args,
 		"-f", "hls",
-		"-hls_time", "6",
+		"-hls_time", strconv.Itoa(profile.HLS.SegmentSeconds),
 		"-hls_list_size", "0",
 		"-hls_flags", "independent_segments",
 		"-master_pl_name", "master.m3u8",
@@ -165,129 +156,112 @@ func segmentForStreamingSingleCommand(ctx context.Context, inputPath, outputDir
 		filepath.Join(outputDir, "%v", "playlist.m3u8"),
 	)
 
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := runFFmpeg(ctx, args...)
 	if err != nil {
 		return fmt.Errorf("single-command segmentation failed: %w, output: %s", err, string(output))
 	}
 	return nil
 }
 
-func appendHLSSingleCommandVideoArgs(args []string, streamIdx int, v hlsVariant, encoder, nvencPreset string) []string {
+// appendHLSSingleCommandVideoArgs appends the H.264 arguments of output stream
+// streamIdx: the rung bitrate, plus the profile's preset and quality (-crf / -cq).
+func appendHLSSingleCommandVideoArgs(args []string, streamIdx int, v HLSRung, profile EncodingProfile, encoder, nvencPreset string) []string {
 	si := strconv.Itoa(streamIdx)
 	switch encoder {
 	case VideoEncoderNVENC:
 		p := NormalizeNVENCPreset(nvencPreset)
-		return append(args,
+		args = append(args,
 			"-c:v:"+si, "h264_nvenc",
 			"-preset", p,
 			"-tune", "hq",
 			"-rc", "vbr",
-			"-cq", "23",
-			"-b:v:"+si, v.VideoBitrate,
 		)
+		if profile.CRF > 0 && profile.VideoBitrate == "" {
+			args = append(args, "-cq", strconv.Itoa(profile.CRF))
+		}
+		return append(args, "-b:v:"+si, v.VideoBitrate)
 	default:
-		return append(args,
+		args = append(args,
 			"-c:v:"+si, "libx264",
-			"-preset", "fast",
-			"-crf", "23",
-			"-b:v:"+si, v.VideoBitrate,
+			"-preset", profile.Preset,
 		)
+		if profile.CRF > 0 && profile.VideoBitrate == "" {
+			args = append(args, "-crf", strconv.Itoa(profile.CRF))
+		}
+		return append(args, "-b:v:"+si, v.VideoBitrate)
 	}
 }
 
-func transcodeHLSVariant(ctx context.Context, inputPath, varDir string, v hlsVariant, encoder, nvencPreset string) error {
+func transcodeHLSVariant(ctx context.Context, inputPath, varDir string, v HLSRung, profile EncodingProfile, encoder, nvencPreset string) error {
 	if strings.ToLower(strings.TrimSpace(encoder)) == VideoEncoderNVENC {
-		return transcodeHLSVariantNVENC(ctx, inputPath, varDir, v, nvencPreset)
+		return transcodeHLSVariantNVENC(ctx, inputPath, varDir, v, profile, nvencPreset)
 	}
-	return transcodeHLSVariantCPU(ctx, inputPath, varDir, v)
+	return transcodeHLSVariantCPU(ctx, inputPath, varDir, v, profile)
 }
 
-func transcodeHLSVariantCPU(ctx context.Context, inputPath, varDir string, v hlsVariant) error {
-	playlistPath := filepath.Join(varDir, "playlist.m3u8")
-	segmentPath := filepath.Join(varDir, "seg_%03d.ts")
-
-	cmd := exec.CommandContext(ctx, "ffmpeg",
+func transcodeHLSVariantCPU(ctx context.Context, inputPath, varDir string, v HLSRung, profile EncodingProfile) error {
+	args := []string{
 		"-i", inputPath,
 		"-c:v", "libx264",
-		"-preset", "fast",
-		"-vf", fmt.Sprintf("scale=-2:%d", v.Height),
-		"-b:v", v.VideoBitrate,
-		"-c:a", "aac",
-		"-b:a", v.AudioBitrate,
-		"-f", "hls",
-		"-hls_time", "6",
-		"-hls_list_size", "0",
-		"-hls_segment_filename", segmentPath,
-		"-y",
-		playlistPath,
-	)
-
-	output, err := cmd.CombinedOutput()
+		"-preset", profile.Preset,
+	}
+	args = append(args, hlsVariantArgs(varDir, v, profile)...)
+	output, err := runFFmpeg(ctx, args...)
 	if err != nil {
 		return fmt.Errorf("segmentation failed %s: %w, output: %s", v.Name, err, string(output))
 	}
 	return nil
 }
 
-func transcodeHLSVariantNVENC(ctx context.Context, inputPath, varDir string, v hlsVariant, nvencPreset string) error {
-	preset := NormalizeNVENCPreset(nvencPreset)
-	playlistPath := filepath.Join(varDir, "playlist.m3u8")
-	segmentPath := filepath.Join(varDir, "seg_%03d.ts")
-
+func transcodeHLSVariantNVENC(ctx context.Context, inputPath, varDir string, v HLSRung, profile EncodingProfile, nvencPreset string) error {
 	args := []string{
 		"-hwaccel", "cuda",
 		"-i", inputPath,
 		"-c:v", "h264_nvenc",
-		"-preset", preset,
+		"-preset", NormalizeNVENCPreset(nvencPreset),
 		"-tune", "hq",
 		"-rc", "vbr",
-		"-cq", "23",
-		"-vf", fmt.Sprintf("scale=-2:%d", v.Height),
-		"-b:v", v.VideoBitrate,
-		"-c:a", "aac",
-		"-b:a", v.AudioBitrate,
-		"-f", "hls",
-		"-hls_time", "6",
-		"-hls_list_size", "0",
-		"-hls_segment_filename", segmentPath,
-		"-y",
-		playlistPath,
 	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
+	if profile.CRF > 0 && profile.VideoBitrate == "" {
+		args = append(args, "-cq", strconv.Itoa(profile.CRF))
+	}
+	args = append(args, hlsVariantArgs(varDir, v, profile)...)
+	output, err := runFFmpeg(ctx, args...)
 	if err == nil {
 		return nil
 	}
 	log.Warn().Err(err).Str("variant", v.Name).Msg("HLS variant NVENC with CUDA decode failed, retrying without hwaccel")
 
-	args = []string{
-		"-i", inputPath,
-		"-c:v", "h264_nvenc",
-		"-preset", preset,
-		"-tune", "hq",
-		"-rc", "vbr",
-		"-cq", "23",
+	output, err = runFFmpeg(ctx, args[2:]...)
+	if err != nil {
+		return fmt.Errorf("segmentation failed %s: %w, output: %s", v.Name, err, string(output))
+	}
+	return nil
+}
+
+// hlsVariantArgs returns the scaling, bitrate, audio and HLS muxer arguments of
+// a per-variant command writing into varDir.
+func hlsVariantArgs(varDir string, v HLSRung, profile EncodingProfile) []string {
+	args := []string{
 		"-vf", fmt.Sprintf("scale=-2:%d", v.Height),
 		"-b:v", v.VideoBitrate,
 		"-c:a", "aac",
 		"-b:a", v.AudioBitrate,
+	}
+	if profile.AudioChannels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.AudioChannels))
+	}
+	return append(args,
 		"-f", "hls",
-		"-hls_time", "6",
+		"-hls_time", strconv.Itoa(profile.HLS.SegmentSeconds),
 		"-hls_list_size", "0",
-		"-hls_segment_filename", segmentPath,
+		"-hls_segment_filename", filepath.Join(varDir, "seg_%03d.ts"),
 		"-y",
-		playlistPath,
-	}
-	cmd = exec.CommandContext(ctx, "ffmpeg", args...)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("segmentation failed %s: %w, output: %s", v.Name, err, string(output))
-	}
-	return nil
+		filepath.Join(varDir, "playlist.m3u8"),
+	)
 }
 
-func writeMasterPlaylist(outputDir string, variants []hlsVariant) error {
+func writeMasterPlaylist(outputDir string, variants []HLSRung) error {
 	var sb strings.Builder
 	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n\n")
 	for _, v := range variants {
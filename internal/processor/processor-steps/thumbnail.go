@@ -17,9 +17,35 @@ type ThumbnailConfig struct {
 	Height int
 }
 
+// DefaultThumbnailConfig returns the thumbnail settings used when a job does not override them.
+func DefaultThumbnailConfig() ThumbnailConfig {
+	return ThumbnailConfig{Count: 5, Width: 320, Height: 180}
+}
+
+// WithDefaults fills zero fields from DefaultThumbnailConfig.
+func (c ThumbnailConfig) WithDefaults() ThumbnailConfig {
+	d := DefaultThumbnailConfig()
+	if c.Count <= 0 {
+		c.Count = d.Count
+	}
+	if c.Width <= 0 {
+		c.Width = d.Width
+	}
+	if c.Height <= 0 {
+		c.Height = d.Height
+	}
+	return c
+}
+
 // GenerateThumbnails generates thumbnails from the video at multiple timestamps.
 func GenerateThumbnails(ctx context.Context, inputPath, outputDir string) error {
-	config := ThumbnailConfig{Count: 5, Width: 320, Height: 180}
+	return GenerateThumbnailsWithConfig(ctx, inputPath, outputDir, DefaultThumbnailConfig())
+}
+
+// GenerateThumbnailsWithConfig generates config.Count thumbnails of config.Width x config.Height.
+// Zero fields in config fall back to the defaults.
+func GenerateThumbnailsWithConfig(ctx context.Context, inputPath, outputDir string, config ThumbnailConfig) error {
+	config = config.WithDefaults()
 
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create thumbnails directory: %w", err)
@@ -60,6 +86,7 @@ func GenerateThumbnails(ctx context.Context, inputPath, outputDir string) error
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to generate thumbnail %d: %w", i, err)
 		}
+		reportProgress(ctx, float64(i)/float64(config.Count))
 	}
 
 	return nil
@@ -3,63 +3,50 @@ package processor_steps
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
-// TranscodeVideo converts the video to standardized formats (MP4, H.264, AAC).
+// TranscodeVideo converts the video to standardized formats (MP4, H.264, AAC) with the default profile.
 // encoder is VideoEncoderCPU or VideoEncoderNVENC; nvencPreset is used only for NVENC (e.g. p4–p7).
 func TranscodeVideo(ctx context.Context, inputPath, outputPath, encoder, nvencPreset string) error {
+	profile, _ := LookupEncodingProfile(DefaultEncodingProfile)
+	return TranscodeVideoWithProfile(ctx, inputPath, outputPath, encoder, nvencPreset, profile)
+}
+
+// TranscodeVideoWithProfile converts the video using the codec, quality and audio settings of profile.
+func TranscodeVideoWithProfile(ctx context.Context, inputPath, outputPath, encoder, nvencPreset string, profile EncodingProfile) error {
 	switch strings.ToLower(strings.TrimSpace(encoder)) {
 	case VideoEncoderNVENC:
 		preset := NormalizeNVENCPreset(nvencPreset)
-		if err := transcodeVideoNVENC(ctx, inputPath, outputPath, preset); err != nil {
+		if err := transcodeVideoNVENC(ctx, inputPath, outputPath, preset, profile); err != nil {
 			log.Warn().Err(err).Msg("NVENC transcode failed, falling back to CPU (libx264)")
-			return transcodeVideoCPU(ctx, inputPath, outputPath)
+			return transcodeVideoCPU(ctx, inputPath, outputPath, profile)
 		}
 		return nil
 	default:
-		return transcodeVideoCPU(ctx, inputPath, outputPath)
+		return transcodeVideoCPU(ctx, inputPath, outputPath, profile)
 	}
 }
 
-func transcodeVideoCPU(ctx context.Context, inputPath, outputPath string) error {
-	cmd := exec.CommandContext(ctx, "ffmpeg",
-		"-i", inputPath,
-		"-c:v", "libx264",
-		"-preset", "fast",
-		"-crf", "23",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		"-movflags", "+faststart",
-		"-y",
-		outputPath,
-	)
-	output, err := cmd.CombinedOutput()
+func transcodeVideoCPU(ctx context.Context, inputPath, outputPath string, profile EncodingProfile) error {
+	args := append([]string{"-i", inputPath}, cpuVideoArgs(profile)...)
+	args = append(args, audioArgs(profile)...)
+	args = append(args, "-movflags", "+faststart", "-y", outputPath)
+	output, err := runFFmpeg(ctx, args...)
 	if err != nil {
-		return fmt.Errorf("transcoding failed: %w, output: %s", err, string(output))
+		return classifyFFmpegFailure(ctx, fmt.Errorf("transcoding failed: %w, output: %s", err, string(output)), output)
 	}
 	return nil
 }
 
-func transcodeVideoNVENC(ctx context.Context, inputPath, outputPath, preset string) error {
-	args := []string{
-		"-hwaccel", "cuda",
-		"-i", inputPath,
-		"-c:v", "h264_nvenc",
-		"-preset", preset,
-		"-tune", "hq",
-		"-rc", "vbr",
-		"-cq", "23",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		"-movflags", "+faststart",
-		"-y", outputPath,
-	}
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	out, err := cmd.CombinedOutput()
+func transcodeVideoNVENC(ctx context.Context, inputPath, outputPath, preset string, profile EncodingProfile) error {
+	args := append([]string{"-hwaccel", "cuda", "-i", inputPath}, nvencVideoArgs(profile, preset)...)
+	args = append(args, audioArgs(profile)...)
+	args = append(args, "-movflags", "+faststart", "-y", outputPath)
+	out, err := runFFmpeg(ctx, args...)
 	if err == nil {
 		return nil
 	}
@@ -67,22 +54,56 @@ func transcodeVideoNVENC(ctx context.Context, inputPath, outputPath, preset stri
 
 	log.Warn().Err(firstErr).Msg("NVENC transcode with -hwaccel cuda failed, retrying without CUDA decode")
 
-	args = []string{
-		"-i", inputPath,
-		"-c:v", "h264_nvenc",
-		"-preset", preset,
-		"-tune", "hq",
-		"-rc", "vbr",
-		"-cq", "23",
-		"-c:a", "aac",
-		"-b:a", "128k",
-		"-movflags", "+faststart",
-		"-y", outputPath,
-	}
-	cmd = exec.CommandContext(ctx, "ffmpeg", args...)
-	out, err = cmd.CombinedOutput()
+	out, err = runFFmpeg(ctx, args[2:]...)
 	if err != nil {
 		return fmt.Errorf("nvenc (no hwaccel): %w, output: %s", err, string(out))
 	}
 	return nil
 }
+
+// cpuVideoArgs returns the libx264/libx265 arguments of profile: constant
+// quality (-crf) unless the profile sets a target bitrate.
+func cpuVideoArgs(profile EncodingProfile) []string {
+	codec := "libx264"
+	if profile.Codec == VideoCodecHEVC {
+		codec = "libx265"
+	}
+	args := []string{"-c:v", codec, "-preset", profile.Preset}
+	if profile.VideoBitrate != "" {
+		args = append(args, "-b:v", profile.VideoBitrate)
+	} else {
+		args = append(args, "-crf", strconv.Itoa(profile.CRF))
+	}
+	if profile.Codec == VideoCodecHEVC {
+		args = append(args, "-tag:v", "hvc1") // plays in Safari/QuickTime
+	}
+	return args
+}
+
+// nvencVideoArgs returns the h264_nvenc/hevc_nvenc arguments of profile; the
+// CRF maps to -cq.
+func nvencVideoArgs(profile EncodingProfile, preset string) []string {
+	codec := "h264_nvenc"
+	if profile.Codec == VideoCodecHEVC {
+		codec = "hevc_nvenc"
+	}
+	args := []string{"-c:v", codec, "-preset", preset, "-tune", "hq", "-rc", "vbr"}
+	if profile.VideoBitrate != "" {
+		args = append(args, "-b:v", profile.VideoBitrate)
+	} else {
+		args = append(args, "-cq", strconv.Itoa(profile.CRF))
+	}
+	if profile.Codec == VideoCodecHEVC {
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return args
+}
+
+// audioArgs returns the AAC arguments of profile.
+func audioArgs(profile EncodingProfile) []string {
+	args := []string{"-c:a", "aac", "-b:a", profile.AudioBitrate}
+	if profile.AudioChannels > 0 {
+		args = append(args, "-ac", strconv.Itoa(profile.AudioChannels))
+	}
+	return args
+}
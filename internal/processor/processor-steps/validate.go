@@ -2,9 +2,12 @@ package processor_steps
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"video-processor/internal/joberrors"
 )
 
 // ValidateVideo validates the format, integrity, and codecs of the video using ffprobe.
@@ -18,12 +21,22 @@ func ValidateVideo(ctx context.Context, inputPath string) error {
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("invalid or corrupted video: %w, output: %s", err, string(output))
+		err = fmt.Errorf("invalid or corrupted video: %w, output: %s", err, string(output))
+		// ffprobe ran and rejected the file: retrying cannot help. Anything else
+		// (timeout, missing binary) is an environment problem.
+		if ctx.Err() != nil {
+			return joberrors.Transient(joberrors.CodeTimeout, err)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return joberrors.Permanent(joberrors.CodeInvalidInput, err)
+		}
+		return joberrors.Transient(joberrors.CodeTransientIO, err)
 	}
 
 	duration := strings.TrimSpace(string(output))
 	if duration == "" || duration == "N/A" {
-		return fmt.Errorf("video has no valid duration")
+		return joberrors.Permanent(joberrors.CodeInvalidInput, fmt.Errorf("video has no valid duration"))
 	}
 
 	return nil
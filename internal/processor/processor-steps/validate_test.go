@@ -3,8 +3,11 @@ package processor_steps
 import (
 	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
+
+	"video-processor/internal/joberrors"
 )
 
 func TestValidateVideo_ValidVideo(t *testing.T) {
@@ -25,6 +28,18 @@ func TestValidateVideo_InvalidVideo(t *testing.T) {
 	}
 }
 
+func TestValidateVideo_InvalidVideoIsPermanent(t *testing.T) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe is not available - skipping test")
+	}
+	invalidPath := CreateInvalidFile(t)
+
+	err := ValidateVideo(context.Background(), invalidPath)
+	if !joberrors.IsPermanent(err) {
+		t.Errorf("ValidateVideo() should return a permanent error for a corrupted file, got: %v", err)
+	}
+}
+
 func TestValidateVideo_NonExistentFile(t *testing.T) {
 	err := ValidateVideo(context.Background(), "/path/that/does/not/exist.mp4")
 	if err == nil {
@@ -2,10 +2,11 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -13,35 +14,115 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	oteltrace "go.opentelemetry.io/otel/trace"
 
+	"video-processor/internal/joberrors"
 	"video-processor/internal/processor/processor-steps"
 	"video-processor/internal/telemetry"
 	"video-processor/metrics"
 )
 
-// Individual timeouts per pipeline step.
+// Budgets of the pipeline steps. The timeouts are those of a short video; the
+// per-second costs leave a wide margin over a CPU encode at realtime speed.
+var (
+	budgetValidate   = StepBudget{Timeout: 30 * time.Second}
+	budgetAnalyze    = StepBudget{Timeout: 30 * time.Second}
+	budgetTranscode  = StepBudget{Timeout: 3 * time.Minute, PerMediaSecond: 1.5, Encodes: true}
+	budgetThumbnails = StepBudget{Timeout: 60 * time.Second, PerMediaSecond: 0.05}
+	budgetAudio      = StepBudget{Timeout: 2 * time.Minute, PerMediaSecond: 0.15}
+	// The preview only encodes the start of the video.
+	budgetPreview   = StepBudget{Timeout: 2 * time.Minute}
+	budgetStreaming = StepBudget{Timeout: 4 * time.Minute, PerMediaSecond: 3, Encodes: true}
+)
+
+// Pipeline step names, used for spans, metrics and Options.Steps.
 const (
-	stepTimeoutValidate   = 30 * time.Second
-	stepTimeoutAnalyze    = 30 * time.Second
-	stepTimeoutTranscode  = 3 * time.Minute
-	stepTimeoutThumbnails = 60 * time.Second
-	stepTimeoutAudio      = 2 * time.Minute
-	stepTimeoutPreview    = 2 * time.Minute
-	stepTimeoutStreaming  = 4 * time.Minute
+	StepValidate   = "validate"
+	StepAnalyze    = "analyze"
+	StepTranscode  = "transcode"
+	StepThumbnails = "thumbnails"
+	StepAudio      = "audio"
+	StepPreview    = "preview"
+	StepStreaming  = "streaming"
 )
 
+// NoSteps is the ParseSteps value that disables every optional step.
+const NoSteps = "none"
+
+// ParseSteps parses a comma-separated list of optional steps (ENABLED_STEPS).
+// An empty list returns nil (all steps); NoSteps returns an empty slice.
+func ParseSteps(list string) ([]string, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	if strings.EqualFold(list, NoSteps) {
+		return []string{}, nil
+	}
+	var steps []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !IsOptionalStep(name) {
+			return nil, fmt.Errorf("unknown step %q (allowed: %s)", name, strings.Join(OptionalSteps(), ", "))
+		}
+		steps = append(steps, name)
+	}
+	return steps, nil
+}
+
+// OptionalSteps returns the non-critical steps that can be selected via
+// Options.Steps: the built-in ones, then those added by RegisterStep.
+func OptionalSteps() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]string(nil), optionalSteps...)
+}
+
+// IsOptionalStep reports whether name is one of OptionalSteps.
+func IsOptionalStep(name string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return isOptionalStep(name)
+}
+
+// isOptionalStep is IsOptionalStep for callers already holding registryMu.
+func isOptionalStep(name string) bool {
+	for _, s := range optionalSteps {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ProcessingResult contains the paths of artifacts generated by the pipeline.
 // TempDir should be removed by the caller after uploads.
 type ProcessingResult struct {
 	TempDir       string
 	ThumbnailsDir string
-	AudioPath     string
-	PreviewPath   string
-	StreamingDir  string
-	Metadata      *processor_steps.VideoMetadata
+	// ThumbnailCount is the number of thumb_NNN.jpg files in ThumbnailsDir.
+	ThumbnailCount int
+	AudioPath      string
+	PreviewPath    string
+	StreamingDir   string
+	Metadata       *processor_steps.VideoMetadata
+	// Artifacts holds every artifact produced, by name, including those of registered steps.
+	Artifacts Artifacts
+	// SkippedSteps lists the optional steps disabled for the job, so their artifacts are
+	// missing on purpose (a failed step's are missing too, but it is not listed).
+	SkippedSteps []string
+	// TimedOutSteps lists the non-critical steps cancelled by the pipeline budget;
+	// the job still succeeds, without their artifacts.
+	TimedOutSteps []string
+	// ResumedSteps lists the steps restored from the checkpoint of an earlier attempt.
+	ResumedSteps []string
+	// SettingsHash fingerprints the settings that produced the artifacts (see SettingsHash);
+	// together with PipelineVersion it stamps the artifact set.
+	SettingsHash string
 }
 
 // Options controls performance behavior of the processing pipeline.
 type Options struct {
+	// ParallelNonCriticalSteps lets independent steps run concurrently, at most
+	// MaxParallelPostTranscodeSteps (clamped to [1, 4]) at a time.
 	ParallelNonCriticalSteps      bool
 	MaxParallelPostTranscodeSteps int
 	HLSSingleCommand              bool
@@ -49,6 +130,44 @@ type Options struct {
 	// VideoEncoder is processor_steps.VideoEncoderCPU or VideoEncoderNVENC (resolved before ProcessVideo).
 	VideoEncoder string
 	NVENCPreset  string
+	// Steps lists the optional steps to run (see OptionalSteps); nil runs all of
+	// them, an empty slice none. The worker sets it from ENABLED_STEPS, or from
+	// the job spec when that lists steps (see ParseSteps).
+	Steps []string
+	// EncodingProfile names the transcode profile; empty uses processor_steps.DefaultEncodingProfile.
+	EncodingProfile string
+	// Thumbnails overrides the thumbnail settings; zero fields keep the defaults.
+	Thumbnails processor_steps.ThumbnailConfig
+	// Timeouts computes the step timeouts and the pipeline budget from the video metadata.
+	Timeouts TimeoutPolicy
+	// Checkpoints, if set, stores the outputs of checkpointed steps (transcode, streaming)
+	// and restores those of an earlier attempt of the job.
+	Checkpoints Checkpoints
+	// Progress, if set, receives live pipeline progress parsed from FFmpeg -progress output.
+	Progress ProgressFunc
+	// OnStepFinished, if set, is called after every executed step with its duration and error.
+	OnStepFinished StepFunc
+	// OnBudget, if set, is called with the pipeline budget once it is set from the
+	// video metadata; until then the budget is PipelineBudget(opts).
+	OnBudget func(budget time.Duration)
+}
+
+// StepFunc receives the outcome of a pipeline step. Steps may run in parallel.
+type StepFunc func(step string, duration time.Duration, err error)
+
+type stepObserverKey struct{}
+
+// stepEnabled reports whether the optional step name should run.
+func (o Options) stepEnabled(name string) bool {
+	if o.Steps == nil {
+		return true
+	}
+	for _, s := range o.Steps {
+		if s == name {
+			return true
+		}
+	}
+	return false
 }
 
 // DefaultOptions returns safe defaults for the processing pipeline.
@@ -60,10 +179,13 @@ func DefaultOptions() Options {
 		HLSSingleCommandFallback:      true,
 		VideoEncoder:                  processor_steps.VideoEncoderCPU,
 		NVENCPreset:                   "p5",
+		Timeouts:                      DefaultTimeoutPolicy(),
 	}
 }
 
-// ProcessVideo executes all steps of the video processing pipeline.
+// ProcessVideo runs the registered steps (see RegisterStep) on inputPath as a
+// dependency graph and returns the artifacts they produced. The transcoded MP4
+// is written to outputPath, the other artifacts under the returned TempDir.
 func ProcessVideo(ctx context.Context, inputPath, outputPath string, opts Options) (*ProcessingResult, error) {
 	baseDir := filepath.Dir(outputPath)
 	videoBaseName := filepath.Base(inputPath)
@@ -74,163 +196,118 @@ func ProcessVideo(ctx context.Context, inputPath, outputPath string, opts Option
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
-	result := &ProcessingResult{TempDir: tempDir}
+	result := &ProcessingResult{TempDir: tempDir, SettingsHash: SettingsHash(opts)}
 
-	// 1. Validation
-	log.Info().Msg("Step 1/7: Validating video")
-	if err := runStep(ctx, "validate", stepTimeoutValidate, func(stepCtx context.Context) error {
-		return processor_steps.ValidateVideo(stepCtx, inputPath)
-	}); err != nil {
-		return result, fmt.Errorf("validation failed: %w", err)
+	tracker := newProgressTracker(opts)
+	ctx = withTracker(ctx, tracker)
+	if opts.OnStepFinished != nil {
+		ctx = context.WithValue(ctx, stepObserverKey{}, opts.OnStepFinished)
 	}
 
-	// 2. Content analysis
-	log.Info().Msg("Step 2/7: Analyzing content")
-	_ = runStep(ctx, "analyze", stepTimeoutAnalyze, func(stepCtx context.Context) error {
-		metadata, err := processor_steps.AnalyzeContent(stepCtx, inputPath)
-		if err != nil {
-			log.Warn().Err(err).Msg("Content analysis failed")
-			return err
-		}
-		result.Metadata = metadata
-		return nil
-	})
-
-	// 3. Transcoding (critical step)
-	log.Info().Msg("Step 3/7: Transcoding video")
-	if err := runStep(ctx, "transcode", stepTimeoutTranscode, func(stepCtx context.Context) error {
-		return processor_steps.TranscodeVideo(stepCtx, inputPath, outputPath, opts.VideoEncoder, opts.NVENCPreset)
-	}); err != nil {
-		return result, fmt.Errorf("transcoding failed: %w", err)
+	profile, ok := processor_steps.LookupEncodingProfile(opts.EncodingProfile)
+	if !ok {
+		return result, joberrors.Permanent(joberrors.CodeInvalidInput, fmt.Errorf("unknown encoding profile %q", opts.EncodingProfile))
 	}
 
-	transcodedPath := outputPath
-
-	if !opts.ParallelNonCriticalSteps {
-		runNonCriticalStepsSequential(ctx, inputPath, transcodedPath, tempDir, result, opts)
-	} else {
-		runNonCriticalStepsParallel(ctx, inputPath, transcodedPath, tempDir, result, opts)
+	job := &Job{InputPath: inputPath, OutputPath: outputPath, TempDir: tempDir, Options: opts, Profile: profile}
+	err := runSteps(ctx, Steps(), job, maxParallelSteps(opts))
+
+	result.Metadata = job.Metadata()
+	result.Artifacts = job.Artifacts()
+	result.SkippedSteps = job.SkippedSteps()
+	result.ResumedSteps = job.ResumedSteps()
+	result.TimedOutSteps = job.TimedOutSteps()
+	result.ThumbnailsDir = result.Artifacts[ArtifactThumbnails]
+	if result.ThumbnailsDir != "" {
+		result.ThumbnailCount = opts.Thumbnails.WithDefaults().Count
+	}
+	result.AudioPath = result.Artifacts[ArtifactAudio]
+	result.PreviewPath = result.Artifacts[ArtifactPreview]
+	result.StreamingDir = result.Artifacts[ArtifactStreaming]
+	if err != nil {
+		return result, err
 	}
 
 	log.Info().Msg("Processing pipeline completed successfully")
 	return result, nil
 }
 
-func runNonCriticalStepsSequential(ctx context.Context, inputPath, transcodedPath, tempDir string, result *ProcessingResult, opts Options) {
-	log.Info().Msg("Step 4/7: Generating thumbnails")
-	thumbnailsDir := filepath.Join(tempDir, "thumbnails")
-	if err := runStep(ctx, "thumbnails", stepTimeoutThumbnails, func(stepCtx context.Context) error {
-		return processor_steps.GenerateThumbnails(stepCtx, transcodedPath, thumbnailsDir)
-	}); err != nil {
-		log.Warn().Err(err).Msg("Failed to generate thumbnails")
-	} else {
-		result.ThumbnailsDir = thumbnailsDir
-	}
-
-	log.Info().Msg("Step 5/7: Extracting audio")
-	audioPath := filepath.Join(tempDir, "audio.mp3")
-	if err := runStep(ctx, "audio", stepTimeoutAudio, func(stepCtx context.Context) error {
-		return processor_steps.ExtractAudio(stepCtx, transcodedPath, audioPath)
-	}); err != nil {
-		log.Warn().Err(err).Msg("Audio extraction failed")
-	} else {
-		result.AudioPath = audioPath
-	}
-
-	log.Info().Msg("Step 6/7: Generating preview")
-	previewPath := filepath.Join(tempDir, "preview.mp4")
-	if err := runStep(ctx, "preview", stepTimeoutPreview, func(stepCtx context.Context) error {
-		return processor_steps.GeneratePreview(stepCtx, transcodedPath, previewPath)
-	}); err != nil {
-		log.Warn().Err(err).Msg("Preview generation failed")
-	} else {
-		result.PreviewPath = previewPath
-	}
-
-	log.Info().Msg("Step 7/7: Segmenting for streaming")
-	streamingDir := filepath.Join(tempDir, "streaming")
-	if err := runStep(ctx, "streaming", stepTimeoutStreaming, func(stepCtx context.Context) error {
-		return processor_steps.SegmentForStreamingWithOptions(stepCtx, inputPath, streamingDir, processor_steps.HLSOptions{
-			SingleCommand: opts.HLSSingleCommand,
-			Fallback:      opts.HLSSingleCommandFallback,
-			VideoEncoder:  opts.VideoEncoder,
-			NVENCPreset:   opts.NVENCPreset,
-		})
-	}); err != nil {
-		log.Warn().Err(err).Msg("Streaming segmentation failed")
-	} else {
-		result.StreamingDir = streamingDir
+// builtinSteps returns the seven steps of the default pipeline:
+// validate → analyze → transcode → thumbnails, audio, preview, streaming.
+// Streaming reads the source, not the transcoded MP4, but still waits for
+// transcode: a failed transcode aborts the job anyway, and the two encodes
+// would compete for the CPU (or NVENC sessions).
+func builtinSteps() []Step {
+	afterTranscode := []string{StepTranscode}
+	return []Step{
+		NewStep(StepValidate, nil, true, budgetValidate, func(ctx context.Context, job *Job) (Artifacts, error) {
+			return nil, processor_steps.ValidateVideo(ctx, job.InputPath)
+		}),
+		// Analyze is not critical: without metadata the job still completes, minus progress and webhook metadata.
+		NewStep(StepAnalyze, []string{StepValidate}, false, budgetAnalyze, func(ctx context.Context, job *Job) (Artifacts, error) {
+			metadata, err := processor_steps.AnalyzeContent(ctx, job.InputPath)
+			if err != nil {
+				return nil, err
+			}
+			job.setMetadata(metadata)
+			trackerFrom(ctx).setDuration(metadata.Duration)
+			return nil, nil
+		}),
+		WithCheckpoint(NewStep(StepTranscode, []string{StepAnalyze}, true, budgetTranscode, func(ctx context.Context, job *Job) (Artifacts, error) {
+			log.Info().Str("profile", job.Profile.Name).Msg("Encoding profile selected")
+			if err := processor_steps.TranscodeVideoWithProfile(ctx, job.InputPath, job.OutputPath, job.Options.VideoEncoder, job.Options.NVENCPreset, job.Profile); err != nil {
+				return nil, err
+			}
+			return Artifacts{ArtifactVideo: job.OutputPath}, nil
+		}), func(job *Job) Artifacts {
+			return Artifacts{ArtifactVideo: job.OutputPath}
+		}, validateVideoCheckpoint),
+		NewStep(StepThumbnails, afterTranscode, false, budgetThumbnails, func(ctx context.Context, job *Job) (Artifacts, error) {
+			dir := filepath.Join(job.TempDir, "thumbnails")
+			if err := processor_steps.GenerateThumbnailsWithConfig(ctx, job.Artifact(ArtifactVideo), dir, job.Options.Thumbnails.WithDefaults()); err != nil {
+				return nil, err
+			}
+			return Artifacts{ArtifactThumbnails: dir}, nil
+		}),
+		NewStep(StepAudio, afterTranscode, false, budgetAudio, func(ctx context.Context, job *Job) (Artifacts, error) {
+			path := filepath.Join(job.TempDir, "audio.mp3")
+			if err := processor_steps.ExtractAudio(ctx, job.Artifact(ArtifactVideo), path); err != nil {
+				return nil, err
+			}
+			return Artifacts{ArtifactAudio: path}, nil
+		}),
+		NewStep(StepPreview, afterTranscode, false, budgetPreview, func(ctx context.Context, job *Job) (Artifacts, error) {
+			path := filepath.Join(job.TempDir, "preview.mp4")
+			if err := processor_steps.GeneratePreviewWithConfig(ctx, job.Artifact(ArtifactVideo), path, job.Profile.Preview); err != nil {
+				return nil, err
+			}
+			return Artifacts{ArtifactPreview: path}, nil
+		}),
+		WithCheckpoint(NewStep(StepStreaming, afterTranscode, false, budgetStreaming, func(ctx context.Context, job *Job) (Artifacts, error) {
+			dir := streamingDir(job)
+			if err := processor_steps.SegmentForStreamingWithOptions(ctx, job.InputPath, dir, processor_steps.HLSOptions{
+				SingleCommand: job.Options.HLSSingleCommand,
+				Fallback:      job.Options.HLSSingleCommandFallback,
+				VideoEncoder:  job.Options.VideoEncoder,
+				NVENCPreset:   job.Options.NVENCPreset,
+				Profile:       job.Profile,
+			}); err != nil {
+				return nil, err
+			}
+			return Artifacts{ArtifactStreaming: dir}, nil
+		}), func(job *Job) Artifacts {
+			return Artifacts{ArtifactStreaming: streamingDir(job)}
+		}, validateHLSCheckpoint),
 	}
 }
 
-func runNonCriticalStepsParallel(ctx context.Context, inputPath, transcodedPath, tempDir string, result *ProcessingResult, opts Options) {
-	maxParallel := opts.MaxParallelPostTranscodeSteps
-	if maxParallel < 1 {
-		maxParallel = 1
-	}
-	if maxParallel > 4 {
-		maxParallel = 4
-	}
-
-	sem := make(chan struct{}, maxParallel)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	run := func(name, startMsg, failMsg string, timeout time.Duration, fn func(context.Context) error, onSuccess func()) {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			log.Info().Msg(startMsg)
-			if err := runStep(ctx, name, timeout, fn); err != nil {
-				log.Warn().Err(err).Msg(failMsg)
-				return
-			}
-			mu.Lock()
-			onSuccess()
-			mu.Unlock()
-		}()
-	}
-
-	thumbnailsDir := filepath.Join(tempDir, "thumbnails")
-	run("thumbnails", "Step 4/7: Generating thumbnails", "Failed to generate thumbnails", stepTimeoutThumbnails, func(stepCtx context.Context) error {
-		return processor_steps.GenerateThumbnails(stepCtx, transcodedPath, thumbnailsDir)
-	}, func() {
-		result.ThumbnailsDir = thumbnailsDir
-	})
-
-	audioPath := filepath.Join(tempDir, "audio.mp3")
-	run("audio", "Step 5/7: Extracting audio", "Audio extraction failed", stepTimeoutAudio, func(stepCtx context.Context) error {
-		return processor_steps.ExtractAudio(stepCtx, transcodedPath, audioPath)
-	}, func() {
-		result.AudioPath = audioPath
-	})
-
-	previewPath := filepath.Join(tempDir, "preview.mp4")
-	run("preview", "Step 6/7: Generating preview", "Preview generation failed", stepTimeoutPreview, func(stepCtx context.Context) error {
-		return processor_steps.GeneratePreview(stepCtx, transcodedPath, previewPath)
-	}, func() {
-		result.PreviewPath = previewPath
-	})
-
-	streamingDir := filepath.Join(tempDir, "streaming")
-	run("streaming", "Step 7/7: Segmenting for streaming", "Streaming segmentation failed", stepTimeoutStreaming, func(stepCtx context.Context) error {
-		return processor_steps.SegmentForStreamingWithOptions(stepCtx, inputPath, streamingDir, processor_steps.HLSOptions{
-			SingleCommand: opts.HLSSingleCommand,
-			Fallback:      opts.HLSSingleCommandFallback,
-			VideoEncoder:  opts.VideoEncoder,
-			NVENCPreset:   opts.NVENCPreset,
-		})
-	}, func() {
-		result.StreamingDir = streamingDir
-	})
-
-	wg.Wait()
+// streamingDir is where the streaming step writes the HLS tree.
+func streamingDir(job *Job) string {
+	return filepath.Join(job.TempDir, "streaming")
 }
 
 // runStep executes a pipeline step within an OTel span and records duration via Prometheus.
+// Progress and the outcome of the step are reported to the tracker and observer carried by ctx, if any.
 // The span is marked as error if the step fails.
 func runStep(ctx context.Context, name string, timeout time.Duration, fn func(context.Context) error) error {
 	stepCtx, span := telemetry.Tracer().Start(ctx, "step/"+name,
@@ -241,9 +318,27 @@ func runStep(ctx context.Context, name string, timeout time.Duration, fn func(co
 	stepCtx, cancel := context.WithTimeout(stepCtx, timeout)
 	defer cancel()
 
+	tracker := trackerFrom(ctx)
+	tracker.update(name, 0)
+	stepCtx = tracker.stepContext(stepCtx, name)
+
 	start := time.Now()
 	err := fn(stepCtx)
-	metrics.ProcessingStepDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	duration := time.Since(start)
+	metrics.ProcessingStepDuration.WithLabelValues(name).Observe(duration.Seconds())
+	status := "success"
+	if err != nil {
+		status = "error"
+		if errors.Is(context.Cause(ctx), errPipelineBudget) {
+			status = "timeout"
+		}
+	}
+	metrics.ProcessingStepsTotal.WithLabelValues(name, status).Inc()
+	if observe, ok := ctx.Value(stepObserverKey{}).(StepFunc); ok {
+		observe(name, duration, err)
+	}
+	// A failed non-critical step is finished too; count it so the total reaches 100%.
+	tracker.update(name, 1)
 
 	if err != nil {
 		span.RecordError(err)
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSteps(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"none", []string{}},
+		{"thumbnails", []string{StepThumbnails}},
+		{" Thumbnails , streaming", []string{StepThumbnails, StepStreaming}},
+	}
+	for _, c := range cases {
+		got, err := ParseSteps(c.in)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseSteps(%q): expected %#v, got %#v (err: %v)", c.in, c.want, got, err)
+		}
+	}
+
+	for _, in := range []string{"transcode", "thumbnails,unknown", "thumbnails,"} {
+		if _, err := ParseSteps(in); err == nil {
+			t.Errorf("ParseSteps(%q): expected an error", in)
+		}
+	}
+
+	none, _ := ParseSteps(NoSteps)
+	if (Options{Steps: none}).stepEnabled(StepThumbnails) {
+		t.Error("expected no optional step to be enabled with none")
+	}
+}
+
+func TestRegisterStep_ExtendsOptionalSteps(t *testing.T) {
+	registryMu.Lock()
+	prevRegistry, prevOptional := registry, optionalSteps
+	registryMu.Unlock()
+	defer func() {
+		registryMu.Lock()
+		registry, optionalSteps = prevRegistry, prevOptional
+		registryMu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			IsOptionalStep("watermark")
+			OptionalSteps()
+		}
+	}()
+	RegisterStep(NewStep("watermark", []string{StepTranscode}, false, budgetValidate, nil))
+	<-done
+
+	if !IsOptionalStep("watermark") {
+		t.Error("expected a registered non-critical step to be optional")
+	}
+	steps := OptionalSteps()
+	steps[0] = "mutated"
+	if OptionalSteps()[0] != StepThumbnails {
+		t.Error("expected OptionalSteps to return a copy")
+	}
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"context"
+	"sync"
+
+	"video-processor/internal/processor/processor-steps"
+)
+
+// ProgressFunc receives the overall pipeline completion (0–100) and the step
+// that reported it. Calls are serialized and come from step goroutines; while
+// one runs, newer updates replace each other and only the latest is delivered.
+type ProgressFunc func(percent float64, step string)
+
+// stepWeights approximates each step's share of the pipeline wall time,
+// used to aggregate per-step progress into an overall percentage.
+var stepWeights = map[string]float64{
+	StepValidate:   1,
+	StepAnalyze:    1,
+	StepTranscode:  45,
+	StepThumbnails: 5,
+	StepAudio:      5,
+	StepPreview:    5,
+	StepStreaming:  38,
+}
+
+// progressTracker aggregates step progress for one ProcessVideo call.
+type progressTracker struct {
+	mu       sync.Mutex
+	weights  map[string]float64
+	total    float64
+	done     map[string]float64
+	duration float64
+	report   ProgressFunc
+
+	// pending is the latest update not delivered yet; reporting is set while a
+	// step goroutine delivers updates.
+	pending   *progressUpdate
+	reporting bool
+}
+
+type progressUpdate struct {
+	percent float64
+	step    string
+}
+
+type trackerKey struct{}
+
+// newProgressTracker returns nil when opts.Progress is not set.
+// Only the steps enabled in opts count toward the total.
+func newProgressTracker(opts Options) *progressTracker {
+	if opts.Progress == nil {
+		return nil
+	}
+	t := &progressTracker{
+		weights: map[string]float64{},
+		done:    map[string]float64{},
+		report:  opts.Progress,
+	}
+	for name, w := range stepWeights {
+		if IsOptionalStep(name) && !opts.stepEnabled(name) {
+			continue
+		}
+		t.weights[name] = w
+		t.total += w
+	}
+	return t
+}
+
+func withTracker(ctx context.Context, t *progressTracker) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+func trackerFrom(ctx context.Context) *progressTracker {
+	t, _ := ctx.Value(trackerKey{}).(*progressTracker)
+	return t
+}
+
+// setDuration sets the media duration FFmpeg out_time is compared against.
+func (t *progressTracker) setDuration(seconds float64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.duration = seconds
+	t.mu.Unlock()
+}
+
+// stepContext makes FFmpeg commands in stepCtx report into the tracker under step.
+func (t *progressTracker) stepContext(stepCtx context.Context, step string) context.Context {
+	if t == nil {
+		return stepCtx
+	}
+	t.mu.Lock()
+	duration := t.duration
+	t.mu.Unlock()
+	return processor_steps.WithProgress(stepCtx, duration, func(fraction float64) {
+		t.update(step, fraction)
+	})
+}
+
+// update records fraction for step (progress never goes backwards, e.g. on an
+// encoder fallback) and reports the new overall percentage.
+func (t *progressTracker) update(step string, fraction float64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if fraction > 1 {
+		fraction = 1
+	}
+	if fraction < t.done[step] {
+		fraction = t.done[step]
+	}
+	t.done[step] = fraction
+	var sum float64
+	for name, f := range t.done {
+		sum += t.weights[name] * f
+	}
+	percent := 0.0
+	if t.total > 0 {
+		percent = sum / t.total * 100
+	}
+	t.pending = &progressUpdate{percent: percent, step: step}
+	if t.reporting {
+		// The delivering goroutine picks it up; the step does not wait for the write.
+		t.mu.Unlock()
+		return
+	}
+	t.reporting = true
+	t.mu.Unlock()
+	t.deliver()
+}
+
+// deliver reports pending updates outside the lock until none is left, so a slow
+// ProgressFunc never blocks the other steps and percentages still arrive in order.
+func (t *progressTracker) deliver() {
+	for {
+		t.mu.Lock()
+		next := t.pending
+		t.pending = nil
+		if next == nil {
+			t.reporting = false
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+		t.report(next.percent, next.step)
+	}
+}
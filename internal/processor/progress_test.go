@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressTracker_SlowReportDoesNotBlockSteps(t *testing.T) {
+	release := make(chan struct{})
+	reported := make(chan float64, 10)
+	tracker := newProgressTracker(Options{Progress: func(percent float64, step string) {
+		if len(reported) == 0 {
+			<-release
+		}
+		reported <- percent
+	}})
+
+	go tracker.update(StepTranscode, 0.1)
+	time.Sleep(50 * time.Millisecond)
+
+	updated := make(chan struct{})
+	go func() {
+		tracker.update(StepStreaming, 0.2)
+		tracker.update(StepStreaming, 0.5)
+		close(updated)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		t.Fatal("update blocked behind a slow progress report")
+	}
+
+	close(release)
+	first := <-reported
+	var last float64
+	select {
+	case last = <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("latest update was not delivered")
+	}
+	if last <= first {
+		t.Errorf("expected percentages in order, got %v then %v", first, last)
+	}
+	select {
+	case extra := <-reported:
+		t.Errorf("expected superseded update to be dropped, got %v", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
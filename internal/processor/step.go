@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"video-processor/internal/processor/processor-steps"
+)
+
+// Artifact names produced by the built-in steps.
+const (
+	ArtifactVideo      = "video"
+	ArtifactThumbnails = "thumbnails"
+	ArtifactAudio      = "audio"
+	ArtifactPreview    = "preview"
+	ArtifactStreaming  = "streaming"
+)
+
+// Artifacts maps artifact names to the local paths (files or directories) a step produced.
+type Artifacts map[string]string
+
+// Step is a node of the processing pipeline. Steps run once all their
+// dependencies have finished, concurrently with the other ready steps.
+type Step interface {
+	Name() string
+	// Deps lists the steps that must finish before this one starts. A failed
+	// non-critical dependency does not prevent the step from running: its
+	// artifacts are just missing (see Job.Require).
+	Deps() []string
+	// Critical steps abort the pipeline when they fail; the others are logged and skipped.
+	Critical() bool
+	// Budget determines the step timeout, from the duration of the video (see TimeoutPolicy).
+	Budget() StepBudget
+	// Run executes the step and returns the artifacts it produced.
+	Run(ctx context.Context, job *Job) (Artifacts, error)
+}
+
+// RunFunc is the body of a step created by NewStep.
+type RunFunc func(ctx context.Context, job *Job) (Artifacts, error)
+
+type funcStep struct {
+	name     string
+	deps     []string
+	critical bool
+	budget   StepBudget
+	run      RunFunc
+}
+
+// NewStep returns a Step that runs fn.
+func NewStep(name string, deps []string, critical bool, budget StepBudget, fn RunFunc) Step {
+	return &funcStep{name: name, deps: deps, critical: critical, budget: budget, run: fn}
+}
+
+func (s *funcStep) Name() string       { return s.name }
+func (s *funcStep) Deps() []string     { return s.deps }
+func (s *funcStep) Critical() bool     { return s.critical }
+func (s *funcStep) Budget() StepBudget { return s.budget }
+
+func (s *funcStep) Run(ctx context.Context, job *Job) (Artifacts, error) {
+	return s.run(ctx, job)
+}
+
+// Job is what the steps of one ProcessVideo call share: its inputs, options,
+// and the metadata and artifacts produced so far. Safe for concurrent use.
+type Job struct {
+	InputPath string
+	// OutputPath is where the transcoded MP4 goes.
+	OutputPath string
+	// TempDir holds the other artifacts; it is removed by the caller after uploads.
+	TempDir string
+	Options Options
+	Profile processor_steps.EncodingProfile
+
+	mu        sync.Mutex
+	metadata  *processor_steps.VideoMetadata
+	artifacts Artifacts
+	skipped   []string
+	resumed   []string
+	timedOut  []string
+}
+
+// Metadata returns the metadata extracted by the analyze step, or nil.
+func (j *Job) Metadata() *processor_steps.VideoMetadata {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.metadata
+}
+
+func (j *Job) setMetadata(m *processor_steps.VideoMetadata) {
+	j.mu.Lock()
+	j.metadata = m
+	j.mu.Unlock()
+}
+
+// Artifact returns the path of the named artifact, or "" if no step produced it.
+func (j *Job) Artifact(name string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.artifacts[name]
+}
+
+// Require returns the path of the named artifact, or an error if no step produced it.
+func (j *Job) Require(name string) (string, error) {
+	if path := j.Artifact(name); path != "" {
+		return path, nil
+	}
+	return "", fmt.Errorf("missing artifact %q", name)
+}
+
+func (j *Job) addArtifacts(a Artifacts) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.artifacts == nil {
+		j.artifacts = Artifacts{}
+	}
+	for name, path := range a {
+		j.artifacts[name] = path
+	}
+}
+
+// Artifacts returns a copy of the artifacts produced so far.
+func (j *Job) Artifacts() Artifacts {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make(Artifacts, len(j.artifacts))
+	for name, path := range j.artifacts {
+		out[name] = path
+	}
+	return out
+}
+
+// SkippedSteps returns the optional steps disabled for the job, in the order they were skipped.
+func (j *Job) SkippedSteps() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]string(nil), j.skipped...)
+}
+
+// ResumedSteps returns the steps restored from a checkpoint instead of run, in the order they were resumed.
+func (j *Job) ResumedSteps() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]string(nil), j.resumed...)
+}
+
+// TimedOutSteps returns the non-critical steps cancelled by the pipeline budget, in the order they returned.
+func (j *Job) TimedOutSteps() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]string(nil), j.timedOut...)
+}
+
+// registryMu guards registry and optionalSteps, which RegisterStep extends.
+var (
+	registryMu    sync.Mutex
+	registry      = builtinSteps()
+	optionalSteps = []string{StepThumbnails, StepAudio, StepPreview, StepStreaming}
+)
+
+// RegisterStep adds s to the pipeline run by ProcessVideo. Non-critical steps
+// become selectable via Options.Steps (see OptionalSteps). It panics if a step
+// with the same name is already registered; call it from an init function.
+func RegisterStep(s Step) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == s.Name() {
+			panic(fmt.Sprintf("processor: step %q registered twice", s.Name()))
+		}
+	}
+	registry = append(registry, s)
+	if !s.Critical() && !isOptionalStep(s.Name()) {
+		optionalSteps = append(optionalSteps, s.Name())
+	}
+}
+
+// Steps returns the registered steps, in registration order.
+func Steps() []Step {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]Step(nil), registry...)
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"video-processor/internal/processor/processor-steps"
+)
+
+// StepBudget is the timeout model of a step, turned into a timeout by
+// TimeoutPolicy.StepTimeout once the video has been analyzed.
+type StepBudget struct {
+	// Timeout applies while the duration of the video is unknown (before or without
+	// analyze), and is the minimum otherwise.
+	Timeout time.Duration
+	// PerMediaSecond is the time allowed per second of video, at 1080p on the CPU encoder.
+	PerMediaSecond float64
+	// Encodes marks steps that encode video: their budget also scales with the
+	// resolution and the encoder speed.
+	Encodes bool
+}
+
+// TimeoutPolicy computes the step timeouts of a job from its VideoMetadata.
+// Zero fields take the values of DefaultTimeoutPolicy.
+type TimeoutPolicy struct {
+	// Base is added to the duration-dependent part of every step budget.
+	Base time.Duration
+	// Multiplier scales the duration-dependent part; raise it on slow machines.
+	Multiplier float64
+	// Ceiling caps every step timeout.
+	Ceiling time.Duration
+	// NVENCFactor scales the budget of encoding steps when the NVENC encoder is used.
+	NVENCFactor float64
+}
+
+// DefaultTimeoutPolicy returns the policy used for zero TimeoutPolicy fields.
+func DefaultTimeoutPolicy() TimeoutPolicy {
+	return TimeoutPolicy{
+		Base:        30 * time.Second,
+		Multiplier:  1,
+		Ceiling:     2 * time.Hour,
+		NVENCFactor: 0.5,
+	}
+}
+
+// Validate rejects negative values.
+func (p TimeoutPolicy) Validate() error {
+	if p.Base < 0 || p.Multiplier < 0 || p.Ceiling < 0 || p.NVENCFactor < 0 {
+		return errors.New("timeout policy values must not be negative")
+	}
+	return nil
+}
+
+func (p TimeoutPolicy) withDefaults() TimeoutPolicy {
+	d := DefaultTimeoutPolicy()
+	if p.Base == 0 {
+		p.Base = d.Base
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = d.Multiplier
+	}
+	if p.Ceiling == 0 {
+		p.Ceiling = d.Ceiling
+	}
+	if p.NVENCFactor == 0 {
+		p.NVENCFactor = d.NVENCFactor
+	}
+	return p
+}
+
+// referencePixels is the resolution PerMediaSecond budgets are expressed for (1080p).
+const referencePixels = 1920 * 1080
+
+// StepTimeout returns the timeout of a step with budget b:
+//
+//	min(Ceiling, max(b.Timeout, Base + Multiplier × PerMediaSecond × duration × scale))
+//
+// where scale is 1, or for encoding steps the pixel count relative to 1080p
+// (clamped to [0.25, 4]) times NVENCFactor with the NVENC encoder. Without
+// metadata it is b.Timeout, capped by Ceiling.
+func (p TimeoutPolicy) StepTimeout(b StepBudget, m *processor_steps.VideoMetadata, encoder string) time.Duration {
+	p = p.withDefaults()
+	timeout := b.Timeout
+	if m != nil && m.Duration > 0 && b.PerMediaSecond > 0 {
+		scale := 1.0
+		if b.Encodes {
+			if m.Width > 0 && m.Height > 0 {
+				scale = math.Max(0.25, math.Min(float64(m.Width*m.Height)/referencePixels, 4))
+			}
+			if encoder == processor_steps.VideoEncoderNVENC {
+				scale *= p.NVENCFactor
+			}
+		}
+		seconds := p.Multiplier * b.PerMediaSecond * m.Duration * scale
+		timeout = max(timeout, p.Base+time.Duration(seconds*float64(time.Second)))
+	}
+	return min(timeout, p.Ceiling)
+}
+
+// pipelineBudget returns the time the steps of job may take in total: the sum
+// of their timeouts, as if they ran one after the other. Steps disabled for the
+// job are not counted.
+func pipelineBudget(steps []Step, job *Job) time.Duration {
+	var total time.Duration
+	for _, s := range steps {
+		if IsOptionalStep(s.Name()) && !job.Options.stepEnabled(s.Name()) {
+			continue
+		}
+		total += job.stepTimeout(s)
+	}
+	return total
+}
+
+// PipelineBudget returns the pipeline budget of a job with opts before its
+// video is analyzed: the sum of the default timeouts of the registered steps
+// it runs. See Options.OnBudget for the budget once the metadata is known.
+func PipelineBudget(opts Options) time.Duration {
+	return pipelineBudget(Steps(), &Job{Options: opts})
+}
+
+// stepTimeout returns the timeout of s for job, given the metadata known so far.
+func (j *Job) stepTimeout(s Step) time.Duration {
+	return j.Options.Timeouts.StepTimeout(s.Budget(), j.Metadata(), j.Options.VideoEncoder)
+}
+
+// errPipelineBudget is the cancellation cause when the pipeline exceeds its budget.
+var errPipelineBudget = errors.New("pipeline budget exceeded")
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"video-processor/internal/joberrors"
+	"video-processor/internal/processor/processor-steps"
+)
+
+func TestStepTimeout(t *testing.T) {
+	policy := TimeoutPolicy{Base: 30 * time.Second, Multiplier: 2, Ceiling: time.Hour, NVENCFactor: 0.5}
+	encode := StepBudget{Timeout: 3 * time.Minute, PerMediaSecond: 1, Encodes: true}
+	video := func(seconds float64, width, height int) *processor_steps.VideoMetadata {
+		return &processor_steps.VideoMetadata{Duration: seconds, Width: width, Height: height}
+	}
+	cases := []struct {
+		name    string
+		budget  StepBudget
+		meta    *processor_steps.VideoMetadata
+		encoder string
+		want    time.Duration
+	}{
+		{"no metadata", encode, nil, "", 3 * time.Minute},
+		{"short video keeps the fixed timeout", encode, video(20, 1920, 1080), "", 3 * time.Minute},
+		{"1080p", encode, video(600, 1920, 1080), "", 30*time.Second + 20*time.Minute},
+		{"4K", encode, video(300, 3840, 2160), "", 30*time.Second + 40*time.Minute},
+		{"low resolution is clamped", encode, video(600, 320, 240), "", 30*time.Second + 5*time.Minute},
+		{"nvenc", encode, video(600, 1920, 1080), processor_steps.VideoEncoderNVENC, 30*time.Second + 10*time.Minute},
+		{"ceiling", encode, video(7200, 1920, 1080), "", time.Hour},
+		{"resolution ignored when not encoding", StepBudget{Timeout: time.Minute, PerMediaSecond: 0.5}, video(600, 3840, 2160), "", 30*time.Second + 10*time.Minute},
+		{"duration ignored without per-second cost", StepBudget{Timeout: time.Minute}, video(600, 1920, 1080), "", time.Minute},
+	}
+	for _, c := range cases {
+		if got := policy.StepTimeout(c.budget, c.meta, c.encoder); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+
+	if got := (TimeoutPolicy{}).StepTimeout(encode, video(600, 1920, 1080), ""); got != 30*time.Second+10*time.Minute {
+		t.Errorf("expected the default policy for zero fields, got %s", got)
+	}
+}
+
+func TestPipelineBudget_SkipsDisabledSteps(t *testing.T) {
+	steps := []Step{
+		NewStep(StepTranscode, nil, true, StepBudget{Timeout: time.Minute}, nil),
+		NewStep(StepThumbnails, nil, false, StepBudget{Timeout: 2 * time.Minute}, nil),
+		NewStep(StepAudio, nil, false, StepBudget{Timeout: 4 * time.Minute}, nil),
+	}
+	job := &Job{Options: Options{Steps: []string{StepAudio}}}
+	if got := pipelineBudget(steps, job); got != 5*time.Minute {
+		t.Errorf("expected the sum of the enabled steps, got %s", got)
+	}
+}
+
+func TestPipelineBudget_Exported(t *testing.T) {
+	all := PipelineBudget(DefaultOptions())
+	none := PipelineBudget(Options{Steps: []string{}})
+	if none <= 0 || none >= all {
+		t.Errorf("expected the budget without optional steps (%s) to be below the full one (%s)", none, all)
+	}
+}
+
+func TestRunSteps_ScalesTimeoutsWithMetadata(t *testing.T) {
+	var timeout time.Duration
+	steps := []Step{
+		NewStep("analyze", nil, false, StepBudget{Timeout: time.Second}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			job.setMetadata(&processor_steps.VideoMetadata{Duration: 600, Width: 1920, Height: 1080})
+			return nil, nil
+		}),
+		NewStep("encode", []string{"analyze"}, true, StepBudget{Timeout: time.Second, PerMediaSecond: 1, Encodes: true}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			deadline, _ := ctx.Deadline()
+			timeout = time.Until(deadline)
+			return nil, nil
+		}),
+	}
+	var budget time.Duration
+	job := &Job{Options: Options{OnBudget: func(b time.Duration) { budget = b }}}
+	if err := runSteps(context.Background(), steps, job, 1); err != nil {
+		t.Fatalf("runSteps: %v", err)
+	}
+	if timeout < 10*time.Minute {
+		t.Errorf("expected a timeout scaled to the 10-minute video, got %s", timeout)
+	}
+	if budget < timeout {
+		t.Errorf("expected OnBudget to report the scaled budget, got %s", budget)
+	}
+}
+
+func TestRunSteps_PipelineBudgetExceeded(t *testing.T) {
+	steps := []Step{
+		// Overruns its own timeout, e.g. a command that ignores cancellation.
+		NewStep("stuck", nil, false, StepBudget{Timeout: 10 * time.Millisecond}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			time.Sleep(100 * time.Millisecond)
+			return nil, nil
+		}),
+		NewStep("critical", []string{"stuck"}, true, StepBudget{Timeout: 30 * time.Millisecond}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+	}
+	err := runSteps(context.Background(), steps, &Job{}, 1)
+	if !errors.Is(err, errPipelineBudget) {
+		t.Fatalf("expected the pipeline budget to be exceeded, got %v", err)
+	}
+	if joberrors.CodeOf(err) != joberrors.CodeTimeout || joberrors.IsPermanent(err) {
+		t.Errorf("expected a transient timeout, got code %s", joberrors.CodeOf(err))
+	}
+}
+
+func TestRunSteps_PipelineBudgetTimesOutNonCriticalSteps(t *testing.T) {
+	noop := func(ctx context.Context, job *Job) (Artifacts, error) { return nil, nil }
+	steps := []Step{
+		NewStep("critical", nil, true, StepBudget{Timeout: 10 * time.Millisecond}, noop),
+		NewStep("fast", []string{"critical"}, false, StepBudget{Timeout: 20 * time.Millisecond}, noop),
+		// Overruns the budget, e.g. a command that ignores cancellation.
+		NewStep("slow", []string{"critical"}, false, StepBudget{Timeout: 20 * time.Millisecond}, func(ctx context.Context, job *Job) (Artifacts, error) {
+			time.Sleep(100 * time.Millisecond)
+			return nil, errors.New("killed")
+		}),
+	}
+	job := &Job{}
+	if err := runSteps(context.Background(), steps, job, 2); err != nil {
+		t.Fatalf("expected the job to succeed without the timed out step, got %v", err)
+	}
+	if got := job.TimedOutSteps(); len(got) != 1 || got[0] != "slow" {
+		t.Errorf("expected slow to be timed out, got %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"video-processor/internal/processor/processor-steps"
+)
+
+// PipelineVersion identifies the processing code. Bump it whenever a change
+// alters the produced artifacts (FFmpeg arguments in processor-steps, the HLS
+// ladder, thumbnail/preview/audio settings), so videos processed by older
+// versions can be found and reprocessed. Profiles loaded from
+// ENCODING_PROFILES_FILE are covered by SettingsHash instead.
+//
+// Version 2: HLS uses the preset and CRF of the job's encoding profile.
+const PipelineVersion = 2
+
+// pipelineSettings are the inputs of SettingsHash. Field order is part of the hash.
+type pipelineSettings struct {
+	Version    int                             `json:"version"`
+	Profile    processor_steps.EncodingProfile `json:"profile"`
+	Encoder    string                          `json:"encoder"`
+	Steps      []string                        `json:"steps"`
+	Thumbnails processor_steps.ThumbnailConfig `json:"thumbnails"`
+}
+
+// SettingsHash fingerprints the settings that shape the artifacts of a job run
+// with opts: pipeline version, encoding profile (with its HLS ladder and
+// preview settings), encoder, enabled steps and thumbnail settings. Jobs with
+// equal hashes produced equivalent artifacts; the hash changes with the job
+// options as well as with the code.
+func SettingsHash(opts Options) string {
+	settings := pipelineSettings{Version: PipelineVersion, Encoder: processor_steps.VideoEncoderCPU}
+	if profile, ok := processor_steps.LookupEncodingProfile(opts.EncodingProfile); ok {
+		settings.Profile = profile
+	} else {
+		settings.Profile.Name = opts.EncodingProfile
+	}
+	if strings.EqualFold(strings.TrimSpace(opts.VideoEncoder), processor_steps.VideoEncoderNVENC) {
+		settings.Encoder = processor_steps.VideoEncoderNVENC + ":" + processor_steps.NormalizeNVENCPreset(opts.NVENCPreset)
+	}
+	for _, step := range OptionalSteps() {
+		if opts.stepEnabled(step) {
+			settings.Steps = append(settings.Steps, step)
+		}
+	}
+	if opts.stepEnabled(StepThumbnails) {
+		settings.Thumbnails = opts.Thumbnails.WithDefaults()
+	}
+	if !opts.stepEnabled(StepStreaming) {
+		settings.Profile.HLS = processor_steps.HLSProfile{}
+	}
+	if !opts.stepEnabled(StepPreview) {
+		settings.Profile.Preview = processor_steps.PreviewConfig{}
+	}
+
+	// Marshalling plain structs and slices cannot fail.
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"testing"
+
+	"video-processor/internal/processor/processor-steps"
+)
+
+func TestSettingsHash(t *testing.T) {
+	base := DefaultOptions()
+	hash := SettingsHash(base)
+	if len(hash) != 16 {
+		t.Fatalf("expected a 16-character hash, got %q", hash)
+	}
+	if SettingsHash(base) != hash {
+		t.Error("expected the hash to be stable")
+	}
+
+	explicit := base
+	explicit.EncodingProfile = processor_steps.DefaultEncodingProfile
+	explicit.Thumbnails = processor_steps.DefaultThumbnailConfig()
+	if SettingsHash(explicit) != hash {
+		t.Error("expected explicit defaults to hash like implicit ones")
+	}
+
+	high := base
+	high.EncodingProfile = "high"
+	if SettingsHash(high) == hash {
+		t.Error("expected the encoding profile to change the hash")
+	}
+
+	noThumbs := base
+	noThumbs.Steps = []string{StepAudio, StepPreview, StepStreaming}
+	otherThumbs := noThumbs
+	otherThumbs.Thumbnails = processor_steps.ThumbnailConfig{Count: 2}
+	if SettingsHash(noThumbs) == hash {
+		t.Error("expected the enabled steps to change the hash")
+	}
+	if SettingsHash(otherThumbs) != SettingsHash(noThumbs) {
+		t.Error("expected thumbnail settings to be ignored when the step is disabled")
+	}
+}
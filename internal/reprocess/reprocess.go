@@ -0,0 +1,115 @@
+// Package reprocess finds videos whose artifacts were produced by an older
+// pipeline version (see processor.PipelineVersion) and enqueues them again.
+//
+// Candidates are the raws still in raw-archived/: only those can be restored,
+// since the lifecycle rule deletes them after 30 days. The version of each
+// comes from its job state (Redis, then the MinIO archive); a video without a
+// state or without stamped artifacts is version 0.
+package reprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"video-processor/queue"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errLimitReached stops the listing once Options.Limit jobs were enqueued.
+var errLimitReached = errors.New("limit reached")
+
+// Options selects the videos to reprocess.
+type Options struct {
+	// BelowVersion selects videos whose artifacts have a pipeline version lower than it.
+	BelowVersion int
+	// Limit caps the number of videos enqueued (or reported on a dry run); 0 means no limit.
+	Limit int
+	// DryRun reports the selection without restoring or enqueueing anything.
+	DryRun bool
+}
+
+// Report summarizes a run.
+type Report struct {
+	Scanned int `json:"scanned"`
+	// Selected lists the outdated videos, enqueued unless DryRun or listed in Failed.
+	Selected []string `json:"selected"`
+	// Skipped counts outdated videos left alone because they are pending or processing.
+	Skipped int `json:"skipped"`
+	// Failed maps videoIDs to the error that prevented their reprocessing.
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Reprocessor wires the storage and queue operations (cmd/reprocess uses MinIO and Redis).
+type Reprocessor struct {
+	// Candidates calls fn with every videoID that has an archived raw.
+	Candidates func(ctx context.Context, fn func(videoID string) error) error
+	// State returns the job state of videoID, or queue.ErrJobNotFound.
+	State func(videoID string) (*queue.JobState, error)
+	// Restore copies the archived raw of videoID back to raw/.
+	Restore func(videoID string) error
+	// Enqueue publishes the job.
+	Enqueue func(spec queue.JobSpec) error
+}
+
+// Run enqueues, at low priority, every candidate whose pipeline version is below
+// opts.BelowVersion. Failures on single videos are reported, not returned.
+func (r *Reprocessor) Run(ctx context.Context, opts Options) (*Report, error) {
+	report := &Report{Selected: []string{}, Failed: map[string]string{}}
+	err := r.Candidates(ctx, func(videoID string) error {
+		report.Scanned++
+		state, err := r.State(videoID)
+		if err != nil && !errors.Is(err, queue.ErrJobNotFound) {
+			report.Failed[videoID] = err.Error()
+			return nil
+		}
+		if state == nil {
+			state = &queue.JobState{VideoID: videoID}
+		}
+		if state.PipelineVersion() >= opts.BelowVersion {
+			return nil
+		}
+		if state.Status == queue.JobStatusPending || state.Status == queue.JobStatusProcessing {
+			report.Skipped++
+			return nil
+		}
+
+		report.Selected = append(report.Selected, videoID)
+		if !opts.DryRun {
+			if err := r.reprocess(state); err != nil {
+				report.Failed[videoID] = err.Error()
+				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to reprocess video")
+			} else {
+				log.Info().Str("videoID", videoID).Int("version", state.PipelineVersion()).Msg("Video enqueued for reprocessing")
+			}
+		}
+		if opts.Limit > 0 && len(report.Selected) >= opts.Limit {
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimitReached) {
+		return report, err
+	}
+	return report, nil
+}
+
+// reprocess restores the raw and enqueues the job with its previous options,
+// at low priority so it never delays fresh uploads.
+func (r *Reprocessor) reprocess(state *queue.JobState) error {
+	spec := queue.JobSpec{VideoID: state.VideoID}
+	if state.Spec != nil {
+		spec = *state.Spec
+	}
+	spec.Priority = queue.PriorityLow
+	spec.ExpiresAt = 0 // the deadline of the original request does not apply
+
+	if err := r.Restore(state.VideoID); err != nil {
+		return fmt.Errorf("failed to restore raw: %w", err)
+	}
+	if err := r.Enqueue(spec); err != nil {
+		return fmt.Errorf("failed to enqueue: %w", err)
+	}
+	return nil
+}
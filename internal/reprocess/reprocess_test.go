@@ -0,0 +1,106 @@
+package reprocess
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"video-processor/queue"
+)
+
+func stamped(videoID string, status queue.JobStatus, version int) *queue.JobState {
+	return &queue.JobState{
+		VideoID:   videoID,
+		Status:    status,
+		Spec:      &queue.JobSpec{VideoID: videoID, Priority: queue.PriorityHigh, Profile: "high", ExpiresAt: 1},
+		Artifacts: &queue.JobArtifacts{Pipeline: &queue.PipelineStamp{Version: version, SettingsHash: "abc"}},
+	}
+}
+
+func newFake(ids []string, states map[string]*queue.JobState) (*Reprocessor, *[]string, *[]queue.JobSpec) {
+	restored := &[]string{}
+	enqueued := &[]queue.JobSpec{}
+	return &Reprocessor{
+		Candidates: func(ctx context.Context, fn func(string) error) error {
+			for _, id := range ids {
+				if err := fn(id); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		State: func(videoID string) (*queue.JobState, error) {
+			if s, ok := states[videoID]; ok {
+				return s, nil
+			}
+			return nil, queue.ErrJobNotFound
+		},
+		Restore: func(videoID string) error {
+			if videoID == "broken" {
+				return errors.New("restore failed")
+			}
+			*restored = append(*restored, videoID)
+			return nil
+		},
+		Enqueue: func(spec queue.JobSpec) error {
+			*enqueued = append(*enqueued, spec)
+			return nil
+		},
+	}, restored, enqueued
+}
+
+func TestRun_EnqueuesOutdatedVideosAtLowPriority(t *testing.T) {
+	states := map[string]*queue.JobState{
+		"old":     stamped("old", queue.JobStatusDone, 1),
+		"current": stamped("current", queue.JobStatusDone, 2),
+		"running": stamped("running", queue.JobStatusProcessing, 1),
+	}
+	r, restored, enqueued := newFake([]string{"old", "current", "running", "unknown", "broken"}, states)
+
+	report, err := r.Run(context.Background(), Options{BelowVersion: 2})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Scanned != 5 || report.Skipped != 1 {
+		t.Errorf("expected 5 scanned and 1 skipped, got %+v", report)
+	}
+	if want := []string{"old", "unknown", "broken"}; !reflect.DeepEqual(report.Selected, want) {
+		t.Errorf("expected selection %v, got %v", want, report.Selected)
+	}
+	if _, ok := report.Failed["broken"]; !ok || len(report.Failed) != 1 {
+		t.Errorf("expected only broken to fail, got %v", report.Failed)
+	}
+	if want := []string{"old", "unknown"}; !reflect.DeepEqual(*restored, want) {
+		t.Errorf("expected restored %v, got %v", want, *restored)
+	}
+
+	if len(*enqueued) != 2 {
+		t.Fatalf("expected 2 enqueued jobs, got %d", len(*enqueued))
+	}
+	old := (*enqueued)[0]
+	if old.Priority != queue.PriorityLow || old.ExpiresAt != 0 || old.Profile != "high" {
+		t.Errorf("expected the previous spec at low priority without deadline, got %+v", old)
+	}
+	if bare := (*enqueued)[1]; bare.VideoID != "unknown" || bare.Priority != queue.PriorityLow {
+		t.Errorf("expected a bare low-priority spec for a video without state, got %+v", bare)
+	}
+	if states["old"].Spec.Priority != queue.PriorityHigh {
+		t.Error("expected the stored spec not to be modified")
+	}
+}
+
+func TestRun_DryRunAndLimit(t *testing.T) {
+	r, restored, enqueued := newFake([]string{"a", "b", "c"}, nil)
+
+	report, err := r.Run(context.Background(), Options{BelowVersion: 1, Limit: 2, DryRun: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(report.Selected, want) {
+		t.Errorf("expected selection %v, got %v", want, report.Selected)
+	}
+	if len(*restored) != 0 || len(*enqueued) != 0 {
+		t.Errorf("expected a dry run to change nothing, got restored %v, enqueued %v", *restored, *enqueued)
+	}
+}
@@ -27,6 +27,19 @@ type Payload struct {
 	Width           *int     `json:"width,omitempty"`
 	Height          *int     `json:"height,omitempty"`
 	Codec           string   `json:"codec,omitempty"`
+	// Metadata echoes the user metadata from the job spec.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Status is the final job status (done, failed, cancelled or expired).
+	Status string `json:"status,omitempty"`
+	// ErrorCode classifies the failure of a failed job (e.g. invalid_input, timeout).
+	ErrorCode string `json:"errorCode,omitempty"`
+	// PipelineVersion and SettingsHash identify what produced the artifacts of a done job.
+	PipelineVersion int    `json:"pipelineVersion,omitempty"`
+	SettingsHash    string `json:"settingsHash,omitempty"`
+	// SkippedSteps lists the optional steps disabled for the job, whose paths are omitted on purpose.
+	SkippedSteps []string `json:"skippedSteps,omitempty"`
+	// TimedOutSteps lists the optional steps cancelled by the pipeline budget, whose paths are missing.
+	TimedOutSteps []string `json:"timedOutSteps,omitempty"`
 }
 
 var httpClient = &http.Client{Timeout: 10 * time.Second}
@@ -0,0 +1,92 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Limits bound the pool size and the host load the autoscaler lets it reach.
+type Limits struct {
+	Min, Max int
+	// MaxLoad is the load per CPU above which the pool sheds workers; 0 disables the check.
+	MaxLoad float64
+	// MinFreeMemory is the available memory (bytes) below which the pool sheds workers.
+	MinFreeMemory uint64
+}
+
+// Autoscaler periodically resizes Pool between Limits.Min and Limits.Max.
+type Autoscaler struct {
+	Pool   *Pool
+	Limits Limits
+	// Interval is the time between two sizing decisions.
+	Interval time.Duration
+	// ScaleDownDelay is how long the queue must stay empty before idle workers are retired.
+	ScaleDownDelay time.Duration
+	// Waiting returns the number of jobs waiting in the queue.
+	Waiting func() (int64, error)
+	// Host returns the host load; nil (or an error) disables the load and memory checks.
+	Host func() (*HostStats, error)
+}
+
+// Run starts the pool at Limits.Min and resizes it every Interval until ctx is cancelled.
+func (a *Autoscaler) Run(ctx context.Context) {
+	a.Pool.Resize(a.Limits.Min)
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	busySince := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		waiting, err := a.Waiting()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to read queue size for worker autoscaling")
+			continue
+		}
+		if waiting > 0 {
+			busySince = time.Now()
+		}
+		var host *HostStats
+		if a.Host != nil {
+			if host, err = a.Host(); err != nil {
+				host = nil
+			}
+		}
+
+		size := a.Pool.Size()
+		idle := time.Since(busySince) >= a.ScaleDownDelay
+		if next := desiredSize(size, waiting, idle, host, a.Limits); next != size {
+			event := log.Info().Int("from", size).Int("to", next).Int64("waiting", waiting)
+			if host != nil {
+				event = event.Float64("load", host.Load).Uint64("free_memory_mb", host.FreeMemory>>20)
+			}
+			event.Msg("Resizing worker pool")
+			a.Pool.Resize(next)
+		}
+	}
+}
+
+// desiredSize returns the pool size for the next interval:
+//   - host overloaded (load or memory): shed one worker, since every worker may run FFmpeg;
+//   - jobs waiting: add one worker per waiting job, at most doubling the pool;
+//   - queue empty for the scale-down delay: retire one worker.
+//
+// The result is clamped to [Min, Max]. Moving by small steps keeps the pool
+// from oscillating, as the load average reacts to new workers with a delay.
+func desiredSize(size int, waiting int64, idle bool, host *HostStats, l Limits) int {
+	switch {
+	case host != nil && ((l.MaxLoad > 0 && host.Load >= l.MaxLoad) || host.FreeMemory < l.MinFreeMemory):
+		size--
+	case waiting > 0:
+		size += int(min(waiting, int64(max(size, 1))))
+	case idle:
+		size--
+	}
+	return max(l.Min, min(size, l.Max))
+}
@@ -0,0 +1,73 @@
+package workerpool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// HostStats is the load of the machine the worker runs on.
+type HostStats struct {
+	// Load is the 1-minute load average divided by the number of CPUs.
+	Load float64
+	// FreeMemory is the memory available to new processes, in bytes.
+	FreeMemory uint64
+}
+
+// ReadHostStats reads the host load from /proc. It fails on systems without
+// procfs; the autoscaler then sizes the pool from the queue alone.
+func ReadHostStats() (*HostStats, error) {
+	loadavg, err := os.Open("/proc/loadavg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load average: %w", err)
+	}
+	defer loadavg.Close()
+	load, err := parseLoadAvg(loadavg)
+	if err != nil {
+		return nil, err
+	}
+
+	meminfo, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	defer meminfo.Close()
+	free, err := parseMemAvailable(meminfo)
+	if err != nil {
+		return nil, err
+	}
+	return &HostStats{Load: load / float64(runtime.NumCPU()), FreeMemory: free}, nil
+}
+
+// parseLoadAvg returns the 1-minute load average of /proc/loadavg.
+func parseLoadAvg(r io.Reader) (float64, error) {
+	var load float64
+	if _, err := fmt.Fscan(r, &load); err != nil {
+		return 0, fmt.Errorf("failed to parse load average: %w", err)
+	}
+	return load, nil
+}
+
+// parseMemAvailable returns MemAvailable of /proc/meminfo in bytes.
+func parseMemAvailable(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse MemAvailable: %w", err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	return 0, fmt.Errorf("MemAvailable not found in memory info")
+}
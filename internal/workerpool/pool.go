@@ -0,0 +1,95 @@
+// Package workerpool runs the job workers as a pool whose size can change at
+// runtime, and an autoscaler that sizes it from the queue backlog and host load.
+//
+// Workers are never interrupted to shrink or drain the pool: a retired worker
+// stops consuming and exits once its current job (if any) is finished.
+package workerpool
+
+import (
+	"context"
+	"sync"
+
+	"video-processor/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RunFunc handles one job. ctx is the pool context, cancelled to interrupt
+// running jobs; stop is also cancelled when the worker is retired or the pool
+// drained, and must only bound waiting for a job, not the job itself.
+type RunFunc func(ctx, stop context.Context, workerID int)
+
+// Pool is a resizable set of workers calling RunFunc in a loop.
+type Pool struct {
+	ctx context.Context
+	run RunFunc
+
+	mu       sync.Mutex
+	stops    []context.CancelFunc // one per live worker, newest last
+	nextID   int
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// New returns an empty pool whose jobs run under ctx. Call Resize to start workers.
+func New(ctx context.Context, run RunFunc) *Pool {
+	return &Pool{ctx: ctx, run: run}
+}
+
+// Size returns the number of workers consuming jobs. Retired workers still
+// finishing a job are not counted.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// Resize starts or retires workers until the pool has n of them. The newest
+// workers are retired first. IDs are never reused: a retired worker may still
+// own a job under its ID.
+func (p *Pool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining || p.ctx.Err() != nil {
+		return
+	}
+	for len(p.stops) < n {
+		p.nextID++
+		stop, cancel := context.WithCancel(p.ctx)
+		p.stops = append(p.stops, cancel)
+		p.wg.Add(1)
+		go p.work(stop, p.nextID)
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		p.stops[last]()
+		p.stops = p.stops[:last]
+	}
+	metrics.WorkerPoolSize.Set(float64(len(p.stops)))
+}
+
+// Drain retires every worker: none consumes a new job, running jobs go on.
+// The pool cannot be resized afterwards; use Wait to know when jobs are done.
+func (p *Pool) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draining = true
+	for _, stop := range p.stops {
+		stop()
+	}
+	p.stops = nil
+	metrics.WorkerPoolSize.Set(0)
+}
+
+// Wait blocks until every worker, including retired ones, has returned.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) work(stop context.Context, workerID int) {
+	defer p.wg.Done()
+	for stop.Err() == nil {
+		p.run(p.ctx, stop, workerID)
+	}
+	log.Info().Int("workerID", workerID).Msg("Worker stopped")
+}
@@ -0,0 +1,145 @@
+package workerpool
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDesiredSize(t *testing.T) {
+	limits := Limits{Min: 1, Max: 8, MaxLoad: 0.9, MinFreeMemory: 512 << 20}
+	calm := &HostStats{Load: 0.3, FreeMemory: 4 << 30}
+
+	cases := []struct {
+		name    string
+		size    int
+		waiting int64
+		idle    bool
+		host    *HostStats
+		want    int
+	}{
+		{"backlog grows by waiting jobs", 2, 1, false, calm, 3},
+		{"growth at most doubles the pool", 2, 10, false, calm, 4},
+		{"growth capped at max", 6, 10, false, calm, 8},
+		{"unknown host load still grows", 2, 1, false, nil, 3},
+		{"busy but empty queue keeps size", 4, 0, false, calm, 4},
+		{"idle shrinks by one", 4, 0, true, calm, 3},
+		{"idle stops at min", 1, 0, true, calm, 1},
+		{"high load sheds a worker despite backlog", 4, 5, false, &HostStats{Load: 1.2, FreeMemory: 4 << 30}, 3},
+		{"low memory sheds a worker", 4, 5, false, &HostStats{Load: 0.2, FreeMemory: 100 << 20}, 3},
+		{"pressure never goes below min", 1, 5, false, &HostStats{Load: 2, FreeMemory: 4 << 30}, 1},
+		{"size outside limits is clamped", 12, 0, false, calm, 8},
+	}
+	for _, c := range cases {
+		if got := desiredSize(c.size, c.waiting, c.idle, c.host, limits); got != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestParseHostStats(t *testing.T) {
+	load, err := parseLoadAvg(strings.NewReader("1.52 0.98 0.40 2/512 12345\n"))
+	if err != nil || load != 1.52 {
+		t.Errorf("expected load 1.52, got %v (err: %v)", load, err)
+	}
+
+	meminfo := "MemTotal:       16384000 kB\nMemFree:         1024000 kB\nMemAvailable:    8192000 kB\n"
+	free, err := parseMemAvailable(strings.NewReader(meminfo))
+	if err != nil || free != 8192000*1024 {
+		t.Errorf("expected %d bytes available, got %d (err: %v)", 8192000*1024, free, err)
+	}
+	if _, err := parseMemAvailable(strings.NewReader("MemTotal: 1 kB\n")); err == nil {
+		t.Error("expected an error without MemAvailable")
+	}
+}
+
+func TestPool_RetiredWorkerFinishesItsJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	started := map[int]int{}
+	running := make(chan struct{}, 3)
+	release := make(chan struct{})
+	pool := New(ctx, func(ctx, stop context.Context, workerID int) {
+		mu.Lock()
+		started[workerID]++
+		first := started[workerID] == 1
+		mu.Unlock()
+		if first {
+			running <- struct{}{}
+		}
+		// A job that ignores stop: retiring must not interrupt it.
+		select {
+		case <-release:
+			time.Sleep(time.Millisecond)
+		case <-ctx.Done():
+		}
+	})
+
+	pool.Resize(3)
+	if pool.Size() != 3 {
+		t.Fatalf("expected 3 workers, got %d", pool.Size())
+	}
+	for i := 0; i < 3; i++ {
+		<-running
+	}
+	pool.Resize(1)
+	if pool.Size() != 1 {
+		t.Fatalf("expected 1 worker after shrinking, got %d", pool.Size())
+	}
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	pool.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if started[2] != 1 || started[3] != 1 {
+		t.Errorf("expected retired workers 2 and 3 to run exactly their current job, got %v", started)
+	}
+	if started[1] < 2 {
+		t.Errorf("expected worker 1 to keep consuming, got %v", started)
+	}
+}
+
+func TestPool_DrainStopsConsumingWithoutInterruptingJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	running := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var interrupted bool
+	var mu sync.Mutex
+	pool := New(ctx, func(ctx, stop context.Context, workerID int) {
+		running <- struct{}{}
+		<-stop.Done()
+		select {
+		case <-release:
+		case <-ctx.Done():
+			mu.Lock()
+			interrupted = true
+			mu.Unlock()
+		}
+	})
+	pool.Resize(2)
+	<-running
+	<-running
+
+	pool.Drain()
+	pool.Resize(3)
+	if pool.Size() != 0 {
+		t.Fatalf("expected a drained pool to stay empty, got %d workers", pool.Size())
+	}
+
+	close(release)
+	pool.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if interrupted {
+		t.Error("expected draining not to cancel running jobs")
+	}
+}
@@ -2,13 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sync"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -20,15 +21,27 @@ import (
 	oteltrace "go.opentelemetry.io/otel/trace"
 
 	"video-processor/config"
+	"video-processor/internal/api"
+	"video-processor/internal/joberrors"
 	"video-processor/internal/processor"
 	processor_steps "video-processor/internal/processor/processor-steps"
 	"video-processor/internal/telemetry"
 	"video-processor/internal/webhook"
+	"video-processor/internal/workerpool"
 	"video-processor/metrics"
 	"video-processor/minio"
 	"video-processor/queue"
 )
 
+// errShutdown is the cancellation cause of jobs still running when the drain period ends.
+var errShutdown = errors.New("worker shutting down")
+
+// errJobTimeout is the cancellation cause of jobs exceeding the pipeline budget plus JOB_IO_TIMEOUT.
+var errJobTimeout = errors.New("job timed out")
+
+// handBackTimeout bounds the wait for interrupted jobs to be requeued after the drain period.
+const handBackTimeout = 15 * time.Second
+
 func main() {
 	// Configure zerolog
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -36,6 +49,19 @@ func main() {
 
 	cfg := config.LoadConfig()
 
+	if _, err := processor.ParseSteps(cfg.EnabledSteps); err != nil {
+		log.Fatal().Err(err).Msg("Invalid ENABLED_STEPS")
+	}
+	if cfg.EncodingProfilesFile != "" {
+		if err := processor_steps.LoadEncodingProfiles(cfg.EncodingProfilesFile); err != nil {
+			log.Fatal().Err(err).Msg("Invalid ENCODING_PROFILES_FILE")
+		}
+		log.Info().Strs("profiles", processor_steps.EncodingProfileNames()).Msg("Encoding profiles loaded")
+	}
+	if err := timeoutPolicy(cfg).Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid STEP_TIMEOUT_* settings")
+	}
+
 	probeCtx, probeCancel := context.WithTimeout(context.Background(), 15*time.Second)
 	videoEncoder := processor_steps.ResolveVideoEncoder(probeCtx, cfg.VideoEncoder)
 	probeCancel()
@@ -50,21 +76,39 @@ func main() {
 	initClients(cfg)
 
 	// Start HTTP server with metrics and health check
-	startHTTPServer(cfg.HTTPPort)
+	startHTTPServer(cfg)
 
 	numWorkers := cfg.WorkerCount
 	if numWorkers == 0 {
 		numWorkers = runtime.NumCPU()
 	}
-
-	log.Info().Int("workers", numWorkers).Msg("Starting video-processor")
+	autoscale := cfg.WorkerMaxCount > 0
+	if autoscale {
+		if cfg.WorkerMinCount < 1 || cfg.WorkerMinCount > cfg.WorkerMaxCount {
+			log.Fatal().Int("min", cfg.WorkerMinCount).Int("max", cfg.WorkerMaxCount).Msg("WORKER_MIN_COUNT must be between 1 and WORKER_MAX_COUNT")
+		}
+		log.Info().Int("min_workers", cfg.WorkerMinCount).Int("max_workers", cfg.WorkerMaxCount).Msg("Starting video-processor with autoscaling")
+	} else {
+		log.Info().Int("workers", numWorkers).Msg("Starting video-processor")
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Goroutine that re-queues orphan jobs (crash during processing)
-	go queue.StartRecovery(ctx, 10*time.Minute)
+	// Goroutine that re-queues orphan jobs (job lease expired after a crash during processing)
+	go queue.StartRecovery(ctx, func(state *queue.JobState) {
+		deleteCheckpoints(cfg, state.VideoID)
+		if state.CallbackURL != "" {
+			go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, state.VideoID, state)
+		}
+	})
+
+	// Goroutine that promotes failed jobs to the queue once their retry backoff elapses
+	go queue.StartDelayedRetries(ctx)
+
+	// Goroutine that stops jobs running on this instance when they are cancelled
+	go queue.StartCancelListener(ctx)
 
-	// Goroutine that updates the queue size metric every 30 seconds
+	// Goroutine that updates the queue and DLQ size metrics every 30 seconds
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
 		defer ticker.Stop()
@@ -73,8 +117,26 @@ func main() {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if size, err := queue.GetQueueSize(); err == nil {
-					metrics.QueueSize.Set(float64(size))
+				if sizes, err := queue.GetQueueSizes(); err == nil {
+					var total int64
+					for priority, size := range sizes {
+						metrics.PriorityQueueSize.WithLabelValues(string(priority)).Set(float64(size))
+						total += size
+					}
+					metrics.QueueSize.Set(float64(total))
+				}
+				if sizes, err := queue.GetTenantQueueSizes(); err == nil {
+					// Reset drops the series of unregistered tenants.
+					metrics.TenantQueueSize.Reset()
+					for tenant, size := range sizes {
+						metrics.TenantQueueSize.WithLabelValues(tenant).Set(float64(size))
+					}
+				}
+				if size, err := queue.GetDLQSize(); err == nil {
+					metrics.DLQSize.Set(float64(size))
+				}
+				if size, err := queue.GetDelayedQueueSize(); err == nil {
+					metrics.DelayedQueueSize.Set(float64(size))
 				}
 			}
 		}
@@ -84,64 +146,90 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	var wg sync.WaitGroup
-
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					log.Info().Int("workerID", workerID).Msg("Shutting down worker gracefully")
-					return
-				default:
-					if err := processNextMessage(ctx, workerID, cfg, videoEncoder); err != nil {
-						if err != context.Canceled {
-							log.Error().Err(err).Int("workerID", workerID).Msg("Error processing message")
-						}
-					}
-				}
+	// Jobs run under their own context so shutdown can stop consuming first and
+	// interrupt running jobs only once the drain period is over.
+	jobsCtx, cancelJobs := context.WithCancelCause(context.Background())
+	defer cancelJobs(nil)
+	scaleCtx, stopScaling := context.WithCancel(ctx)
+	defer stopScaling()
+
+	pool := workerpool.New(jobsCtx, func(ctx, stop context.Context, workerID int) {
+		if err := processNextMessage(ctx, stop, workerID, cfg, videoEncoder); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error().Err(err).Int("workerID", workerID).Msg("Error processing message")
 			}
-		}(i + 1)
+		}
+	})
+	if autoscale {
+		scaler := &workerpool.Autoscaler{
+			Pool: pool,
+			Limits: workerpool.Limits{
+				Min:           cfg.WorkerMinCount,
+				Max:           cfg.WorkerMaxCount,
+				MaxLoad:       cfg.WorkerScaleMaxLoad,
+				MinFreeMemory: cfg.WorkerScaleMinFreeMemoryMB << 20,
+			},
+			Interval:       cfg.WorkerScaleInterval,
+			ScaleDownDelay: cfg.WorkerScaleDownDelay,
+			Waiting:        queue.GetQueueSize,
+			Host:           workerpool.ReadHostStats,
+		}
+		go scaler.Run(scaleCtx)
+	} else {
+		pool.Resize(numWorkers)
 	}
 
 	// Wait for interrupt signal
 	<-sigChan
-	log.Warn().Msg("Shutdown signal received. Starting graceful shutdown")
+	log.Warn().Dur("drain_timeout", cfg.ShutdownDrainTimeout).Msg("Shutdown signal received. Draining workers")
 
-	// Cancel context to initiate shutdown
-	cancel()
+	// Stop consuming; running jobs may finish during the drain period.
+	stopScaling()
+	pool.Drain()
 
-	// Wait for workers with timeout
-	shutdownComplete := make(chan struct{})
+	drained := make(chan struct{})
 	go func() {
-		wg.Wait()
-		close(shutdownComplete)
+		pool.Wait()
+		close(drained)
 	}()
 
-	// Set a timeout for shutdown (30 seconds)
 	select {
-	case <-shutdownComplete:
-		log.Info().Msg("All workers shut down normally")
-	case <-time.After(30 * time.Second):
-		log.Warn().Msg("Timeout reached. Forcing remaining workers to stop")
+	case <-drained:
+		log.Info().Msg("All workers finished their jobs")
+	case <-time.After(cfg.ShutdownDrainTimeout):
+		// Interrupted jobs are requeued by their worker (see handBackJob) instead of
+		// waiting in flight for orphan recovery.
+		log.Warn().Msg("Drain timeout reached. Cancelling and requeueing unfinished jobs")
+		cancelJobs(errShutdown)
+		select {
+		case <-drained:
+			log.Info().Msg("Unfinished jobs requeued")
+		case <-time.After(handBackTimeout):
+			log.Error().Msg("Workers did not stop in time, orphan recovery will requeue their jobs")
+		}
 	}
 
+	// Background goroutines (recovery, retries, cancel listener) stop last: they serve the drain.
+	cancel()
 	log.Info().Msg("Program terminated")
 }
 
 func initClients(cfg *config.Config) {
 	queue.InitRedisClient(cfg)
 	minio.InitMinioClient(cfg)
+	queue.SetJobArchive(minio.JobRecords{})
 }
 
-func startHTTPServer(port string) {
+func startHTTPServer(cfg *config.Config) {
 	http.HandleFunc("/health", healthCheckHandler)
 	http.Handle("/metrics", promhttp.Handler())
+	api.RegisterRoutes(http.DefaultServeMux, cfg, func(state *queue.JobState) {
+		if state.CallbackURL != "" {
+			go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, state.VideoID, state)
+		}
+	})
 
-	addr := ":" + port
+	addr := ":" + cfg.HTTPPort
 	go func() {
 		log.Info().Str("address", addr).Msg("HTTP server started")
 		if err := http.ListenAndServe(addr, nil); err != nil {
@@ -169,10 +257,12 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, videoEncoder string) error {
-	// Blocks until a message is received or ctx is canceled (shutdown).
-	// BRPOPLPUSH atomically moves the job to the processing queue.
-	msg, err := queue.ConsumeMessage(ctx)
+// processNextMessage waits for a job and processes it. stop only bounds the wait
+// (shutdown or the worker being retired by the pool); the job itself runs under ctx.
+func processNextMessage(ctx, stop context.Context, workerID int, cfg *config.Config, videoEncoder string) error {
+	// Blocks until a message is received or stop is canceled.
+	// The queue backend keeps the job in flight until it is acknowledged.
+	msg, err := queue.ConsumeMessage(stop)
 	if err != nil {
 		return err
 	}
@@ -181,10 +271,45 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 	}
 
 	videoID := msg.VideoID
+
+	// Cancelled while waiting, or after being consumed but before the pending entry could be removed.
+	if queue.CancelRequested(videoID) {
+		finishCancelledJob(cfg, videoID)
+		if err := queue.AcknowledgeMessage(msg); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to acknowledge job")
+		}
+		return nil
+	}
+
+	// Waited past its deadline (e.g. during an outage): the result is no longer wanted.
+	if msg.Spec.Expired(time.Now()) {
+		finishExpiredJob(cfg, videoID)
+		if err := queue.AcknowledgeMessage(msg); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to acknowledge job")
+		}
+		return nil
+	}
+
 	log.Info().Int("workerID", workerID).Str("videoID", videoID).Msg("Processing video")
 
-	if err := queue.SetJobProcessing(videoID); err != nil {
+	// Heartbeated lease: keeps orphan recovery away while this worker is alive.
+	// Without it nothing proves this worker owns the job, so it is handed back unprocessed.
+	owner := queue.NewJobOwner(workerID)
+	lease, err := queue.AcquireLease(videoID, owner)
+	if err != nil {
+		if err := queue.RequeueJob(videoID); err != nil {
+			log.Error().Err(err).Str("videoID", videoID).Msg("Failed to requeue job without lease, leaving it in flight")
+		} else if err := queue.AcknowledgeMessage(msg); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to acknowledge job")
+		}
+		return fmt.Errorf("failed to acquire job lease: %w", err)
+	}
+
+	attempt := 1
+	if state, err := queue.SetJobProcessing(videoID, owner); err != nil {
 		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job state to processing")
+	} else {
+		attempt = state.Attempt()
 	}
 
 	// Root job span — covers the entire processing including upload
@@ -193,35 +318,96 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 	)
 	defer span.End()
 
-	processCtx, cancel := context.WithTimeout(jobCtx, 5*time.Minute)
+	// CancelJob cancels watchCtx with queue.ErrJobCancelled, killing the running FFmpeg commands.
+	watchCtx, release := queue.WatchCancellation(jobCtx, videoID)
+	defer release()
+	// A lost lease cancels it with queue.ErrLeaseLost: another worker may have the job by now.
+	watchCtx, stopLeaseWatch := lease.Context(watchCtx)
+	defer stopLeaseWatch()
+
+	// ProcessVideo bounds the pipeline by its budget, derived from the video duration
+	// (STEP_TIMEOUT_*). The job deadline caps it and expires the job instead of failing it.
+	var processCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := msg.Spec.Deadline(); ok {
+		processCtx, cancel = context.WithDeadlineCause(watchCtx, deadline, queue.ErrJobExpired)
+	} else {
+		processCtx, cancel = context.WithCancel(watchCtx)
+	}
 	defer cancel()
 
+	// The job timeout bounds download, pipeline and uploads together: the pipeline budget
+	// plus JOB_IO_TIMEOUT, moved once the budget is set from the video metadata.
+	opts := toProcessorOptions(cfg, videoEncoder, msg.Spec)
+	processCtx, cancelTimeout := context.WithCancelCause(processCtx)
+	defer cancelTimeout(nil)
+	jobStart := time.Now()
+	jobTimer := time.AfterFunc(cfg.JobIOTimeout+processor.PipelineBudget(opts), func() { cancelTimeout(errJobTimeout) })
+	defer jobTimer.Stop()
+	opts.OnBudget = func(budget time.Duration) {
+		if jobTimer.Stop() {
+			jobTimer.Reset(time.Until(jobStart.Add(cfg.JobIOTimeout + budget)))
+		}
+	}
+
 	done := make(chan error, 1)
 
 	go func() {
 		// jobErr tracks the final error for the defer below.
 		var jobErr error
+		// uploads records every artifact upload started, so a cancelled job can remove them.
+		var uploads jobUploads
 
 		metrics.ActiveWorkers.Inc()
 		defer metrics.ActiveWorkers.Dec()
 
 		defer func() {
-			if jobErr != nil {
+			if jobErr != nil && errors.Is(context.Cause(processCtx), errJobTimeout) {
+				jobErr = joberrors.Transient(joberrors.CodeTimeout, fmt.Errorf("%w: %w", errJobTimeout, jobErr))
+			}
+			ack := true
+			if errors.Is(context.Cause(processCtx), queue.ErrLeaseLost) {
+				// The job may have been requeued to another worker: its message, state and
+				// lease are no longer ours, so nothing is acked or written.
+				ack = false
+				metrics.VideosProcessedTotal.WithLabelValues("lease_lost").Inc()
+				log.Error().Str("videoID", videoID).Msg("Job lease lost, dropping the job")
+			} else if jobErr != nil && errors.Is(context.Cause(processCtx), queue.ErrJobCancelled) {
+				uploads.remove(videoID)
+				finishCancelledJob(cfg, videoID)
+			} else if jobErr != nil && errors.Is(context.Cause(processCtx), queue.ErrJobExpired) {
+				finishExpiredJob(cfg, videoID)
+			} else if jobErr != nil && errors.Is(context.Cause(processCtx), errShutdown) {
+				// Left in flight if the requeue failed: orphan recovery takes it once the lease is gone.
+				ack = handBackJob(videoID)
+			} else if jobErr != nil {
+				permanent := joberrors.IsPermanent(jobErr)
+				metrics.JobFailuresTotal.WithLabelValues(string(joberrors.CodeOf(jobErr)), strconv.FormatBool(permanent)).Inc()
 				state, err := queue.SetJobFailed(videoID, jobErr)
 				if err != nil {
 					log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job state to failed")
 				}
-				if state != nil && state.RetryCount <= queue.MaxJobRetries {
-					if err := queue.RequeueJob(videoID); err != nil {
-						log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to requeue job")
+				if permanent {
+					// Retrying cannot fix the input: the failed state is terminal.
+					log.Error().Str("videoID", videoID).Str("code", string(joberrors.CodeOf(jobErr))).Str("error", jobErr.Error()).Msg("Job failed permanently, not retrying")
+					deleteCheckpoints(cfg, videoID)
+					if state != nil && state.CallbackURL != "" {
+						go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, videoID, state)
+					}
+				} else if state != nil && state.RetryCount <= queue.MaxJobRetries {
+					if next, err := queue.ScheduleRetry(videoID); err != nil {
+						// Left in flight: orphan recovery requeues it once the lease is released.
+						ack = false
+						log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to schedule job retry")
 					} else {
-						log.Warn().Str("videoID", videoID).Int("attempt", state.RetryCount).Int("max", queue.MaxJobRetries).Msg("Job scheduled for retry")
+						log.Warn().Str("videoID", videoID).Int("attempt", state.RetryCount).Int("max", queue.MaxJobRetries).Time("next_attempt_at", next).Msg("Job scheduled for retry")
 					}
 				} else {
-					if err := queue.MoveToDLQ(videoID); err != nil {
+					if err := queue.MoveToDLQ(msg.Spec); err != nil {
 						log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to move job to dead letter queue")
 					} else {
 						log.Error().Str("videoID", videoID).Str("error", jobErr.Error()).Msg("Job moved to dead letter queue after exhausting retries")
+						deleteCheckpoints(cfg, videoID)
 						// Notify the API about the permanent failure (retries exhausted)
 						if state != nil && state.CallbackURL != "" {
 							go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, videoID, state)
@@ -229,9 +415,15 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 					}
 				}
 			}
-			if err := queue.AcknowledgeMessage(videoID); err != nil {
-				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to acknowledge job")
+			if ack {
+				if err := queue.AcknowledgeMessage(msg); err != nil {
+					log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to acknowledge job")
+				}
 			}
+			// Released only after the ack so recovery never sees an unleased in-flight job
+			// (unless the hand-back failed, which recovery must then pick up). A lost lease
+			// is left alone: the release only deletes a key still held by this worker.
+			lease.Release()
 		}()
 
 		startTime := time.Now()
@@ -244,8 +436,9 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 			os.Remove(outputPath)
 		}()
 
-		if err := minio.DownloadVideo(minio.VideoTypeRaw, videoID, inputPath); err != nil {
-			jobErr = fmt.Errorf("failed to download video: %v", err)
+		rawETag, err := minio.DownloadVideo(processCtx, minio.VideoTypeRaw, videoID, inputPath)
+		if err != nil {
+			jobErr = fmt.Errorf("failed to download video: %w", err)
 			metrics.VideosProcessedTotal.WithLabelValues("error").Inc()
 			done <- jobErr
 			return
@@ -254,62 +447,78 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 			metrics.VideoSizeBytes.Observe(float64(info.Size()))
 		}
 
-		result, err := processor.ProcessVideo(processCtx, inputPath, outputPath, processor.Options{
-			ParallelNonCriticalSteps:      cfg.ParallelNonCriticalSteps,
-			MaxParallelPostTranscodeSteps: cfg.MaxParallelPostTranscodeSteps,
-			HLSSingleCommand:              cfg.HLSSingleCommand,
-			HLSSingleCommandFallback:      cfg.HLSSingleCommandFallback,
-			VideoEncoder:                  videoEncoder,
-			NVENCPreset:                   cfg.NVENCPreset,
-		})
+		opts.Progress = queue.NewProgressRecorder(videoID, cfg.ProgressUpdateInterval)
+		opts.OnStepFinished = func(step string, duration time.Duration, err error) {
+			queue.RecordStepEvent(videoID, attempt, owner, step, duration, err)
+		}
+		if cfg.CheckpointsEnabled {
+			opts.Checkpoints = minio.Checkpoints{
+				VideoID: videoID,
+				Attempt: attempt,
+				// The raw ETag keeps a re-uploaded video from resuming the outputs of the old one.
+				Fingerprint: fmt.Sprintf("%d-%s-%s", processor.PipelineVersion, processor.SettingsHash(opts), rawETag),
+			}
+		}
+		result, err := processor.ProcessVideo(processCtx, inputPath, outputPath, opts)
 		if result != nil {
 			defer os.RemoveAll(result.TempDir)
 		}
+		if interrupted(processCtx) {
+			// Stop before anything is uploaded; local files are removed by the defers above.
+			jobErr = context.Cause(processCtx)
+			done <- jobErr
+			return
+		}
 		if err != nil {
-			jobErr = fmt.Errorf("failed to process video: %v", err)
+			jobErr = fmt.Errorf("failed to process video: %w", err)
 			metrics.VideosProcessedTotal.WithLabelValues("error").Inc()
 			done <- jobErr
 			return
 		}
 
 		processedID := videoID + "_processed"
-		if err := minio.UploadVideo(outputPath, minio.VideoTypeProcessed, processedID); err != nil {
-			jobErr = fmt.Errorf("failed to upload video: %v", err)
+		uploads.files = append(uploads.files, "processed/"+processedID)
+		if err := minio.UploadVideo(processCtx, outputPath, minio.VideoTypeProcessed, processedID); err != nil {
+			jobErr = fmt.Errorf("failed to upload video: %w", err)
 			metrics.VideosProcessedTotal.WithLabelValues("error").Inc()
 			done <- jobErr
 			return
 		}
 
-		// Archive the original raw to raw-archived/ (auto-deleted after 30 days).
-		// Error is not fatal — the video is already processed and artifacts are in MinIO.
-		if err := minio.ArchiveRawVideo(videoID); err != nil {
-			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to archive raw — will be retained in raw/")
-		}
-
 		// Upload optional artifacts generated by the pipeline
 		if result.ThumbnailsDir != "" {
-			if err := minio.UploadDirectory(result.ThumbnailsDir, "thumbnails/"+videoID); err != nil {
+			uploads.dirs = append(uploads.dirs, "thumbnails/"+videoID)
+			if err := minio.UploadDirectory(processCtx, result.ThumbnailsDir, "thumbnails/"+videoID); err != nil {
 				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to upload thumbnails")
 			}
 		}
 		if result.AudioPath != "" {
-			if err := minio.UploadFile(result.AudioPath, "audio/"+videoID+".mp3"); err != nil {
+			uploads.files = append(uploads.files, "audio/"+videoID+".mp3")
+			if err := minio.UploadFile(processCtx, result.AudioPath, "audio/"+videoID+".mp3"); err != nil {
 				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to upload audio")
 			}
 		}
 		if result.PreviewPath != "" {
-			if err := minio.UploadFile(result.PreviewPath, "preview/"+videoID+"_preview.mp4"); err != nil {
+			uploads.files = append(uploads.files, "preview/"+videoID+"_preview.mp4")
+			if err := minio.UploadFile(processCtx, result.PreviewPath, "preview/"+videoID+"_preview.mp4"); err != nil {
 				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to upload preview")
 			}
 		}
 		if result.StreamingDir != "" {
-			if err := minio.UploadDirectory(result.StreamingDir, "hls/"+videoID); err != nil {
+			uploads.dirs = append(uploads.dirs, "hls/"+videoID)
+			if err := minio.UploadDirectory(processCtx, result.StreamingDir, "hls/"+videoID); err != nil {
 				log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to upload HLS segments")
 			}
 		}
 
+		// The uploads above stop with the context: a job stopped during them is not done.
+		if processCtx.Err() != nil {
+			jobErr = context.Cause(processCtx)
+			done <- jobErr
+			return
+		}
 		if err := queue.PublishSuccessMessage(processedID); err != nil {
-			jobErr = fmt.Errorf("failed to publish success message: %v", err)
+			jobErr = fmt.Errorf("failed to publish success message: %w", err)
 			metrics.VideosProcessedTotal.WithLabelValues("error").Inc()
 			done <- jobErr
 			return
@@ -320,7 +529,13 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 		metadata := toJobMetadata(result)
 		if err := queue.SetJobDone(videoID, artifacts, metadata); err != nil {
 			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job state to done")
+		} else if err := minio.ArchiveRawVideo(videoID); err != nil {
+			// Archive the original raw to raw-archived/ (auto-deleted after 30 days) only once
+			// the job is done: a retry or requeue before that still needs it in raw/.
+			// Error is not fatal — the video is already processed and artifacts are in MinIO.
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to archive raw — will be retained in raw/")
 		}
+		deleteCheckpoints(cfg, videoID)
 
 		// Notify the API about success
 		if state, err := queue.GetJobState(videoID); err == nil && state != nil && state.CallbackURL != "" {
@@ -339,10 +554,150 @@ func processNextMessage(ctx context.Context, workerID int, cfg *config.Config, v
 	case err := <-done:
 		return err
 	case <-processCtx.Done():
+		if interrupted(processCtx) {
+			// Wait for the job goroutine to clean up (and requeue on shutdown) before returning.
+			<-done
+			return nil
+		}
+		if errors.Is(context.Cause(processCtx), errJobTimeout) {
+			// Download and uploads stop with the context: wait for the failure to be recorded.
+			return <-done
+		}
 		return fmt.Errorf("operation canceled: %v", processCtx.Err())
 	}
 }
 
+// interrupted reports whether the job context was stopped on purpose (cancellation,
+// deadline, shutdown or lost lease) rather than by a timeout.
+func interrupted(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.Is(cause, queue.ErrJobCancelled) || errors.Is(cause, queue.ErrJobExpired) ||
+		errors.Is(cause, errShutdown) || leaseLost(ctx)
+}
+
+// leaseLost reports whether the job context was cancelled because its lease was lost.
+func leaseLost(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), queue.ErrLeaseLost)
+}
+
+// finishExpiredJob marks the job as expired and notifies its callback URL.
+func finishExpiredJob(cfg *config.Config, videoID string) {
+	state, err := queue.SetJobExpired(videoID)
+	if err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job state to expired")
+		return
+	}
+	deleteCheckpoints(cfg, videoID)
+	metrics.VideosProcessedTotal.WithLabelValues("expired").Inc()
+	log.Warn().Str("videoID", videoID).Msg("Job expired before completion")
+	if state.CallbackURL != "" {
+		go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, videoID, state)
+	}
+}
+
+// jobUploads lists the MinIO objects (files) and prefixes (dirs) a job uploaded to.
+type jobUploads struct {
+	files []string
+	dirs  []string
+}
+
+// remove deletes the uploads of a job that ends without being done, so a cancelled
+// job leaves no partial artifacts. Failures are only logged.
+func (u jobUploads) remove(videoID string) {
+	ctx := context.Background()
+	for _, file := range u.files {
+		if err := minio.DeleteFile(ctx, file); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to delete uploaded artifact")
+		}
+	}
+	for _, dir := range u.dirs {
+		if err := minio.DeleteDirectory(ctx, dir); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to delete uploaded artifacts")
+		}
+	}
+}
+
+// finishCancelledJob marks the job as cancelled and notifies its callback URL.
+func finishCancelledJob(cfg *config.Config, videoID string) {
+	state, err := queue.SetJobCancelled(videoID)
+	if err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job state to cancelled")
+		return
+	}
+	deleteCheckpoints(cfg, videoID)
+	metrics.VideosProcessedTotal.WithLabelValues("cancelled").Inc()
+	log.Info().Str("videoID", videoID).Msg("Job cancelled")
+	if state.CallbackURL != "" {
+		go notifyWebhook(state.CallbackURL, cfg.WebhookSecret, videoID, state)
+	}
+}
+
+// deleteCheckpoints removes the step checkpoints of a job that will not be retried
+// (done, or failed, cancelled or expired for good). Leftovers (failed deletes, jobs
+// that never complete) expire with the staging/ lifecycle rule.
+func deleteCheckpoints(cfg *config.Config, videoID string) {
+	if !cfg.CheckpointsEnabled {
+		return
+	}
+	if err := minio.DeleteCheckpoints(context.Background(), videoID); err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to delete step checkpoints")
+	}
+}
+
+// handBackJob requeues a job interrupted by shutdown and reports whether it did.
+// The interruption is not the job's fault, so it does not count as a retry.
+func handBackJob(videoID string) bool {
+	if err := queue.RequeueJob(videoID); err != nil {
+		log.Error().Err(err).Str("videoID", videoID).Msg("Failed to requeue job interrupted by shutdown")
+		return false
+	}
+	metrics.VideosProcessedTotal.WithLabelValues("requeued").Inc()
+	log.Warn().Str("videoID", videoID).Msg("Job interrupted by shutdown, requeued")
+	return true
+}
+
+// toProcessorOptions builds the pipeline options from the worker config and the job spec.
+// Spec fields left empty keep the deployment defaults; spec steps replace ENABLED_STEPS.
+func toProcessorOptions(cfg *config.Config, videoEncoder string, spec *queue.JobSpec) processor.Options {
+	// ENABLED_STEPS is validated at startup.
+	enabledSteps, _ := processor.ParseSteps(cfg.EnabledSteps)
+	opts := processor.Options{
+		Steps:                         enabledSteps,
+		ParallelNonCriticalSteps:      cfg.ParallelNonCriticalSteps,
+		MaxParallelPostTranscodeSteps: cfg.MaxParallelPostTranscodeSteps,
+		HLSSingleCommand:              cfg.HLSSingleCommand,
+		HLSSingleCommandFallback:      cfg.HLSSingleCommandFallback,
+		VideoEncoder:                  videoEncoder,
+		NVENCPreset:                   cfg.NVENCPreset,
+		Timeouts:                      timeoutPolicy(cfg),
+	}
+	if spec == nil {
+		return opts
+	}
+	if len(spec.Steps) > 0 {
+		opts.Steps = spec.Steps
+	}
+	opts.EncodingProfile = spec.Profile
+	if spec.Thumbnails != nil {
+		opts.Thumbnails = processor_steps.ThumbnailConfig{
+			Count:  spec.Thumbnails.Count,
+			Width:  spec.Thumbnails.Width,
+			Height: spec.Thumbnails.Height,
+		}
+	}
+	return opts
+}
+
+// timeoutPolicy returns the step timeout settings of the worker config.
+func timeoutPolicy(cfg *config.Config) processor.TimeoutPolicy {
+	return processor.TimeoutPolicy{
+		Base:        cfg.StepTimeoutBase,
+		Multiplier:  cfg.StepTimeoutMultiplier,
+		Ceiling:     cfg.StepTimeoutCeiling,
+		NVENCFactor: cfg.StepTimeoutNVENCFactor,
+	}
+}
+
 // toJobMetadata converts pipeline metadata to the queue package type.
 func toJobMetadata(result *processor.ProcessingResult) *queue.VideoMetadata {
 	if result.Metadata == nil {
@@ -361,13 +716,19 @@ func toJobMetadata(result *processor.ProcessingResult) *queue.VideoMetadata {
 }
 
 // buildJobArtifacts builds the artifacts object with MinIO paths
-// from the pipeline result. Only includes artifacts that were generated.
+// from the pipeline result. Only includes artifacts that were generated:
+// those of skipped (SkippedSteps), timed out (TimedOutSteps) or failed steps are omitted.
 func buildJobArtifacts(videoID, processedID string, result *processor.ProcessingResult) queue.JobArtifacts {
 	artifacts := queue.JobArtifacts{
-		Video: "processed/" + processedID,
+		Video:         "processed/" + processedID,
+		Pipeline:      &queue.PipelineStamp{Version: processor.PipelineVersion, SettingsHash: result.SettingsHash},
+		SkippedSteps:  result.SkippedSteps,
+		ResumedSteps:  result.ResumedSteps,
+		TimedOutSteps: result.TimedOutSteps,
 	}
 	if result.ThumbnailsDir != "" {
 		artifacts.Thumbnails = "thumbnails/" + videoID
+		artifacts.ThumbnailCount = result.ThumbnailCount
 	}
 	if result.AudioPath != "" {
 		artifacts.Audio = "audio/" + videoID + ".mp3"
@@ -389,6 +750,10 @@ func notifyWebhook(callbackURL, secret, videoID string, state *queue.JobState) {
 	payload := webhook.Payload{
 		VideoID: videoID,
 		Success: success,
+		Status:  string(state.Status),
+	}
+	if state.Status == queue.JobStatusFailed {
+		payload.ErrorCode = string(state.ErrorCode)
 	}
 
 	if success && state.Artifacts != nil {
@@ -396,16 +761,30 @@ func notifyWebhook(callbackURL, secret, videoID string, state *queue.JobState) {
 		payload.PreviewPath = state.Artifacts.Preview
 		payload.HlsPath = state.Artifacts.HLS
 		payload.AudioPath = state.Artifacts.Audio
+		if stamp := state.Artifacts.Pipeline; stamp != nil {
+			payload.PipelineVersion = stamp.Version
+			payload.SettingsHash = stamp.SettingsHash
+		}
+		payload.SkippedSteps = state.Artifacts.SkippedSteps
+		payload.TimedOutSteps = state.Artifacts.TimedOutSteps
 
 		if state.Artifacts.Thumbnails != "" {
-			paths := make([]string, 5)
-			for i := 1; i <= 5; i++ {
+			count := state.Artifacts.ThumbnailCount
+			if count == 0 {
+				count = processor_steps.DefaultThumbnailConfig().Count // states written before the count was recorded
+			}
+			paths := make([]string, count)
+			for i := 1; i <= count; i++ {
 				paths[i-1] = fmt.Sprintf("%s/thumb_%03d.jpg", state.Artifacts.Thumbnails, i)
 			}
 			payload.ThumbnailPaths = paths
 		}
 	}
 
+	if state.Spec != nil {
+		payload.Metadata = state.Spec.Metadata
+	}
+
 	if success && state.Metadata != nil {
 		size := state.Metadata.Size
 		duration := state.Metadata.Duration
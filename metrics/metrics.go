@@ -34,6 +34,15 @@ var (
 		[]string{"step"}, // validate, transcode, thumbnail, etc.
 	)
 
+	// ProcessingStepsTotal counts pipeline steps by outcome
+	ProcessingStepsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "video_processing_steps_total",
+			Help: "Total number of pipeline steps by outcome",
+		},
+		[]string{"step", "status"}, // success, error or skipped (disabled for the job)
+	)
+
 	// ActiveWorkers counts the number of active workers
 	ActiveWorkers = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -42,6 +51,14 @@ var (
 		},
 	)
 
+	// WorkerPoolSize counts the workers consuming jobs (changes with autoscaling)
+	WorkerPoolSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_size",
+			Help: "Current number of workers in the pool",
+		},
+	)
+
 	// QueueSize measures the queue size
 	QueueSize = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -50,6 +67,49 @@ var (
 		},
 	)
 
+	// PriorityQueueSize measures the size of each priority queue
+	PriorityQueueSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "priority_queue_size",
+			Help: "Current size of each priority request queue",
+		},
+		[]string{"priority"}, // high, normal, low
+	)
+
+	// TenantQueueSize measures the jobs waiting per tenant (all priorities)
+	TenantQueueSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_queue_size",
+			Help: "Current number of jobs waiting per tenant",
+		},
+		[]string{"tenant"}, // "default" for jobs without a tenant
+	)
+
+	// DLQSize measures the dead letter queue depth
+	DLQSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "dlq_size",
+			Help: "Current number of jobs in the dead letter queue",
+		},
+	)
+
+	// DelayedQueueSize measures the retries waiting for their backoff to elapse
+	DelayedQueueSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "delayed_queue_size",
+			Help: "Current number of jobs waiting for a delayed retry",
+		},
+	)
+
+	// JobFailuresTotal counts failed attempts by error code and retry class
+	JobFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_failures_total",
+			Help: "Total number of failed job attempts by error code",
+		},
+		[]string{"code", "permanent"},
+	)
+
 	// VideoSizeBytes measures the size of processed videos
 	VideoSizeBytes = promauto.NewHistogram(
 		prometheus.HistogramOpts{
@@ -0,0 +1,236 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"video-processor/internal/circuitbreaker"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+// stagingPrefix holds the step checkpoints of unfinished jobs, under
+// staging/<videoID>/<attempt>/. Leftovers expire after stagingLifecycleDays.
+const stagingPrefix = "staging/"
+
+// stagingLifecycleDays is the number of days checkpoints are kept when no attempt cleans them up.
+const stagingLifecycleDays = 7
+
+// Checkpoints stores the step checkpoints of one attempt of a job in the staging
+// area. It implements processor.Checkpoints.
+//
+// The files of a step go under staging/<videoID>/<attempt>/<step>/<artifact>/;
+// the manifest staging/<videoID>/<attempt>/<step>.json, written last, lists them
+// with their size. A checkpoint without manifest (interrupted save), with a
+// different Fingerprint or with a file of the wrong size is ignored.
+type Checkpoints struct {
+	VideoID string
+	Attempt int
+	// Fingerprint identifies the pipeline and settings the outputs were produced
+	// with (e.g. pipeline version and settings hash); only equal ones are restored.
+	Fingerprint string
+}
+
+// checkpointManifest is the JSON manifest of a step checkpoint.
+type checkpointManifest struct {
+	Fingerprint string `json:"fingerprint"`
+	// Artifacts maps artifact names to their files.
+	Artifacts map[string]checkpointArtifact `json:"artifacts"`
+}
+
+type checkpointArtifact struct {
+	// Dir is true for a directory tree; Files are then relative to it.
+	Dir   bool             `json:"dir,omitempty"`
+	Files []checkpointFile `json:"files"`
+}
+
+type checkpointFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+func checkpointPrefix(videoID string, attempt int) string {
+	return stagingPrefix + videoID + "/" + strconv.Itoa(attempt) + "/"
+}
+
+// Save uploads the artifacts of step, then its manifest.
+func (c Checkpoints) Save(ctx context.Context, step string, artifacts map[string]string) error {
+	prefix := checkpointPrefix(c.VideoID, c.Attempt)
+	manifest := checkpointManifest{Fingerprint: c.Fingerprint, Artifacts: map[string]checkpointArtifact{}}
+	for name, localPath := range artifacts {
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		artifact := checkpointArtifact{Dir: info.IsDir()}
+		objectPrefix := prefix + step + "/" + name
+		if !info.IsDir() {
+			if err := UploadFile(ctx, localPath, objectPrefix); err != nil {
+				return fmt.Errorf("failed to checkpoint %s: %w", name, err)
+			}
+			artifact.Files = []checkpointFile{{Size: info.Size()}}
+			manifest.Artifacts[name] = artifact
+			continue
+		}
+		err = filepath.WalkDir(localPath, func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(localPath, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if err := UploadFile(ctx, p, objectPrefix+"/"+rel); err != nil {
+				return err
+			}
+			artifact.Files = append(artifact.Files, checkpointFile{Path: rel, Size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to checkpoint %s: %w", name, err)
+		}
+		manifest.Artifacts[name] = artifact
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint manifest: %w", err)
+	}
+	if err := putObject(ctx, prefix+step+".json", data, "application/json"); err != nil {
+		return fmt.Errorf("failed to write checkpoint manifest: %w", err)
+	}
+	log.Info().Str("videoID", c.VideoID).Int("attempt", c.Attempt).Str("step", step).Msg("Step checkpointed")
+	return nil
+}
+
+// Restore downloads the checkpoint of step saved by the latest attempt that has
+// one, from the current attempt (a job handed back on shutdown keeps its
+// attempt) down to the first.
+func (c Checkpoints) Restore(ctx context.Context, step string, targets map[string]string) (bool, error) {
+	for attempt := c.Attempt; attempt >= 1; attempt-- {
+		prefix := checkpointPrefix(c.VideoID, attempt)
+		manifest, err := readCheckpointManifest(ctx, prefix+step+".json")
+		if err != nil {
+			return false, err
+		}
+		if manifest == nil {
+			continue
+		}
+		if manifest.Fingerprint != c.Fingerprint {
+			log.Info().Str("videoID", c.VideoID).Int("attempt", attempt).Str("step", step).Msg("Checkpoint made with other pipeline settings, ignoring it")
+			return false, nil
+		}
+		for name, target := range targets {
+			artifact, ok := manifest.Artifacts[name]
+			if !ok {
+				return false, nil
+			}
+			if err := restoreArtifact(ctx, prefix+step+"/"+name, artifact, target); err != nil {
+				return false, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+		}
+		log.Info().Str("videoID", c.VideoID).Int("attempt", attempt).Str("step", step).Msg("Checkpoint restored")
+		return true, nil
+	}
+	return false, nil
+}
+
+// restoreArtifact downloads the files of artifact to target, checking their size.
+func restoreArtifact(ctx context.Context, objectPrefix string, artifact checkpointArtifact, target string) error {
+	if artifact.Dir {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+	for _, f := range artifact.Files {
+		object, dst := objectPrefix, target
+		if artifact.Dir {
+			object = objectPrefix + "/" + f.Path
+			dst = filepath.Join(target, filepath.FromSlash(path.Clean("/"+f.Path)))
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+			return nil, client.FGetObject(ctx, cfg.MinioBucketName, object, dst, minio.GetObjectOptions{})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", object, err)
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			return err
+		}
+		if info.Size() != f.Size {
+			return fmt.Errorf("%s has %d bytes, expected %d", object, info.Size(), f.Size)
+		}
+	}
+	return nil
+}
+
+// readCheckpointManifest returns the manifest at object, or nil if there is none.
+func readCheckpointManifest(ctx context.Context, object string) (*checkpointManifest, error) {
+	result, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		obj, err := client.GetObject(ctx, cfg.MinioBucketName, object, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defer obj.Close()
+		data, err := io.ReadAll(obj)
+		if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return []byte(nil), nil
+		}
+		return data, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint manifest: %w", err)
+	}
+	data := result.([]byte)
+	if data == nil {
+		return nil, nil
+	}
+	var manifest checkpointManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint manifest %s: %w", object, err)
+	}
+	return &manifest, nil
+}
+
+// DeleteCheckpoints removes the checkpoints of every attempt of videoID, once
+// the job no longer needs them.
+func DeleteCheckpoints(ctx context.Context, videoID string) error {
+	prefix := stagingPrefix + videoID + "/"
+	objects := client.ListObjects(ctx, cfg.MinioBucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	var firstErr error
+	for err := range client.RemoveObjects(ctx, cfg.MinioBucketName, objects, minio.RemoveObjectsOptions{}) {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete checkpoint %s: %w", err.ObjectName, err.Err)
+		}
+	}
+	return firstErr
+}
+
+func putObject(ctx context.Context, object string, data []byte, contentType string) error {
+	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		_, err := client.PutObject(ctx, cfg.MinioBucketName, object, bytes.NewReader(data), int64(len(data)),
+			minio.PutObjectOptions{ContentType: contentType})
+		return nil, err
+	})
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"video-processor/config"
 	"video-processor/internal/circuitbreaker"
+	"video-processor/internal/joberrors"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -64,8 +65,9 @@ func InitMinioClient(config *config.Config) {
 	configureRawArchivedLifecycle()
 }
 
-// configureRawArchivedLifecycle configures the lifecycle rule that automatically deletes
-// objects in raw-archived/ after rawArchivedLifecycleDays days.
+// configureRawArchivedLifecycle configures the lifecycle rules that automatically delete
+// objects in raw-archived/ after rawArchivedLifecycleDays days, and leftover checkpoints
+// in staging/ after stagingLifecycleDays days.
 func configureRawArchivedLifecycle() {
 	ctx := context.Background()
 	prefix := string(VideoTypeRawArchived) + "/"
@@ -81,6 +83,16 @@ func configureRawArchivedLifecycle() {
 				Days: lifecycle.ExpirationDays(rawArchivedLifecycleDays),
 			},
 		},
+		{
+			ID:     "expire-staging",
+			Status: "Enabled",
+			RuleFilter: lifecycle.Filter{
+				Prefix: stagingPrefix,
+			},
+			Expiration: lifecycle.Expiration{
+				Days: lifecycle.ExpirationDays(stagingLifecycleDays),
+			},
+		},
 	}
 	if err := client.SetBucketLifecycle(ctx, cfg.MinioBucketName, lcConfig); err != nil {
 		log.Warn().Err(err).Msg("Failed to configure lifecycle rule for raw-archived")
@@ -93,30 +105,39 @@ func getObjectPath(videoType VideoType, objectID string) string {
 	return string(videoType) + "/" + objectID
 }
 
-func DownloadVideo(videoType VideoType, objectID, destPath string) error {
-	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
-		return nil, downloadVideo(videoType, objectID, destPath)
+// DownloadVideo downloads the object to destPath and returns its ETag.
+func DownloadVideo(ctx context.Context, videoType VideoType, objectID, destPath string) (string, error) {
+	result, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		return downloadVideo(ctx, videoType, objectID, destPath)
 	})
-	return err
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
 }
 
-func downloadVideo(videoType VideoType, objectID, destPath string) error {
-	ctx := context.Background()
+func downloadVideo(ctx context.Context, videoType VideoType, objectID, destPath string) (string, error) {
 	objectPath := getObjectPath(videoType, objectID)
 
 	info, err := client.StatObject(ctx, cfg.MinioBucketName, objectPath, minio.StatObjectOptions{})
 	if err != nil {
-		log.Error().Err(err).Str("object", objectPath).Msg("Object not found")
-		return err
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			err = joberrors.Permanent(joberrors.CodeNotFound, err)
+		} else {
+			err = joberrors.Transient(joberrors.CodeTransientIO, err)
+		}
+		log.Error().Err(err).Str("object", objectPath).Str("code", string(joberrors.CodeOf(err))).Msg("Failed to stat object")
+		return "", err
 	}
 	if maxBytes := cfg.MaxFileSizeMB * 1024 * 1024; info.Size > maxBytes {
-		return fmt.Errorf("video too large: %.0fMB (maximum: %dMB)", float64(info.Size)/1024/1024, cfg.MaxFileSizeMB)
+		return "", joberrors.Permanent(joberrors.CodeTooLarge,
+			fmt.Errorf("video too large: %.0fMB (maximum: %dMB)", float64(info.Size)/1024/1024, cfg.MaxFileSizeMB))
 	}
 
 	object, err := client.GetObject(ctx, cfg.MinioBucketName, objectPath, minio.GetObjectOptions{})
 	if err != nil {
 		log.Error().Err(err).Str("object", objectPath).Msg("Failed to get object")
-		return err
+		return "", joberrors.Transient(joberrors.CodeTransientIO, err)
 	}
 	defer object.Close()
 	log.Info().Str("object", objectPath).Msg("Download started")
@@ -124,28 +145,42 @@ func downloadVideo(videoType VideoType, objectID, destPath string) error {
 	outFile, err := os.Create(destPath)
 	if err != nil {
 		log.Error().Err(err).Str("destPath", destPath).Msg("Failed to create destination file")
-		return err
+		return "", err
 	}
 	defer outFile.Close()
 
 	if _, err := outFile.ReadFrom(object); err != nil {
 		log.Error().Err(err).Str("object", objectPath).Msg("Failed to read object")
-		return err
+		return "", joberrors.Transient(joberrors.CodeTransientIO, err)
 	}
 	log.Info().Str("object", objectPath).Str("destPath", destPath).Msg("Download completed")
 
-	return nil
+	return info.ETag, nil
 }
 
-func UploadVideo(srcPath string, videoType VideoType, objectID string) error {
+// StatVideo returns the size in bytes of the stored object without downloading it.
+func StatVideo(videoType VideoType, objectID string) (int64, error) {
+	result, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		info, err := client.StatObject(context.Background(), cfg.MinioBucketName, getObjectPath(videoType, objectID), minio.StatObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return info.Size, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+func UploadVideo(ctx context.Context, srcPath string, videoType VideoType, objectID string) error {
 	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
-		return nil, uploadVideo(srcPath, videoType, objectID)
+		return nil, uploadVideo(ctx, srcPath, videoType, objectID)
 	})
 	return err
 }
 
-func uploadVideo(srcPath string, videoType VideoType, objectID string) error {
-	ctx := context.Background()
+func uploadVideo(ctx context.Context, srcPath string, videoType VideoType, objectID string) error {
 	file, err := os.Open(srcPath)
 	if err != nil {
 		return fmt.Errorf("[minio] failed to open file for upload: %w", err)
@@ -167,15 +202,14 @@ func uploadVideo(srcPath string, videoType VideoType, objectID string) error {
 }
 
 // UploadFile uploads any file to a specific path in MinIO.
-func UploadFile(srcPath, objectPath string) error {
+func UploadFile(ctx context.Context, srcPath, objectPath string) error {
 	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
-		return nil, uploadFile(srcPath, objectPath)
+		return nil, uploadFile(ctx, srcPath, objectPath)
 	})
 	return err
 }
 
-func uploadFile(srcPath, objectPath string) error {
-	ctx := context.Background()
+func uploadFile(ctx context.Context, srcPath, objectPath string) error {
 	file, err := os.Open(srcPath)
 	if err != nil {
 		return fmt.Errorf("[minio] failed to open file for upload: %w", err)
@@ -198,7 +232,7 @@ func uploadFile(srcPath, objectPath string) error {
 
 // UploadDirectory recursively uploads all files from srcDir to MinIO
 // with the given objectPrefix, preserving the subfolder structure.
-func UploadDirectory(srcDir, objectPrefix string) error {
+func UploadDirectory(ctx context.Context, srcDir, objectPrefix string) error {
 	entries, err := os.ReadDir(srcDir)
 	if err != nil {
 		return fmt.Errorf("[minio] failed to read directory %s: %w", srcDir, err)
@@ -207,18 +241,38 @@ func UploadDirectory(srcDir, objectPrefix string) error {
 		srcPath := filepath.Join(srcDir, entry.Name())
 		objectPath := objectPrefix + "/" + entry.Name()
 		if entry.IsDir() {
-			if err := UploadDirectory(srcPath, objectPath); err != nil {
+			if err := UploadDirectory(ctx, srcPath, objectPath); err != nil {
 				return err
 			}
 			continue
 		}
-		if err := UploadFile(srcPath, objectPath); err != nil {
+		if err := UploadFile(ctx, srcPath, objectPath); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// DeleteFile removes the object at objectPath; a missing object is not an error.
+func DeleteFile(ctx context.Context, objectPath string) error {
+	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		return nil, client.RemoveObject(ctx, cfg.MinioBucketName, objectPath, minio.RemoveObjectOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", objectPath, err)
+	}
+	return nil
+}
+
+// DeleteDirectory removes every object under objectPrefix/, as uploaded by UploadDirectory.
+func DeleteDirectory(ctx context.Context, objectPrefix string) error {
+	objects := client.ListObjects(ctx, cfg.MinioBucketName, minio.ListObjectsOptions{Prefix: objectPrefix + "/", Recursive: true})
+	for err := range client.RemoveObjects(ctx, cfg.MinioBucketName, objects, minio.RemoveObjectsOptions{}) {
+		return fmt.Errorf("failed to delete %s: %w", err.ObjectName, err.Err)
+	}
+	return nil
+}
+
 func contentTypeByExt(ext string) string {
 	switch strings.ToLower(ext) {
 	case ".jpg", ".jpeg":
@@ -265,6 +319,58 @@ func archiveRawVideo(videoID string) error {
 	return nil
 }
 
+// RestoreRawVideo makes raw/<videoID> available again for reprocessing by
+// copying it back from raw-archived/. The archived copy is kept (the next
+// successful run archives over it); a raw that still exists is left as is.
+func RestoreRawVideo(videoID string) error {
+	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		return nil, restoreRawVideo(videoID)
+	})
+	return err
+}
+
+func restoreRawVideo(videoID string) error {
+	ctx := context.Background()
+	rawPath := getObjectPath(VideoTypeRaw, videoID)
+	archivedPath := getObjectPath(VideoTypeRawArchived, videoID)
+
+	if _, err := client.StatObject(ctx, cfg.MinioBucketName, rawPath, minio.StatObjectOptions{}); err == nil {
+		return nil
+	} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return joberrors.Transient(joberrors.CodeTransientIO, fmt.Errorf("failed to stat raw: %w", err))
+	}
+
+	src := minio.CopySrcOptions{Bucket: cfg.MinioBucketName, Object: archivedPath}
+	dst := minio.CopyDestOptions{Bucket: cfg.MinioBucketName, Object: rawPath}
+	if _, err := client.CopyObject(ctx, dst, src); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return joberrors.Permanent(joberrors.CodeNotFound, fmt.Errorf("archived raw %s not found (expired after %d days?): %w", archivedPath, rawArchivedLifecycleDays, err))
+		}
+		return joberrors.Transient(joberrors.CodeTransientIO, fmt.Errorf("failed to restore raw from archive: %w", err))
+	}
+
+	log.Info().Str("src", archivedPath).Str("dst", rawPath).Msg("Raw restored from archive")
+	return nil
+}
+
+// EachArchivedRawVideo calls fn with the videoID of every raw in raw-archived/,
+// i.e. every processed video that can still be reprocessed. It stops at the
+// first error of fn or of the listing.
+func EachArchivedRawVideo(ctx context.Context, fn func(videoID string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the listing goroutine when fn returns early
+	prefix := string(VideoTypeRawArchived) + "/"
+	for object := range client.ListObjects(ctx, cfg.MinioBucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list archived raws: %w", object.Err)
+		}
+		if err := fn(strings.TrimPrefix(object.Key, prefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // HealthCheck checks whether the MinIO client is healthy.
 func HealthCheck() error {
 	ctx := context.Background()
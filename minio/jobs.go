@@ -0,0 +1,59 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"video-processor/internal/circuitbreaker"
+	"video-processor/internal/joberrors"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// jobRecordPrefix holds the archived job states, one JSON document per video.
+const jobRecordPrefix = "jobs/"
+
+// JobRecords stores job records under jobs/<videoID>.json. It implements queue.JobArchive.
+type JobRecords struct{}
+
+func jobRecordPath(videoID string) string {
+	return jobRecordPrefix + videoID + ".json"
+}
+
+// PutJobRecord writes (or overwrites) the record of videoID.
+func (JobRecords) PutJobRecord(videoID string, data []byte) error {
+	_, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		_, err := client.PutObject(context.Background(), cfg.MinioBucketName, jobRecordPath(videoID),
+			bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+		return nil, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive job record: %w", err)
+	}
+	return nil
+}
+
+// GetJobRecord reads the record of videoID. A missing record is reported as an
+// error wrapping fs.ErrNotExist; it is classified as permanent so that lookups
+// of unknown jobs do not count against the circuit breaker.
+func (JobRecords) GetJobRecord(videoID string) ([]byte, error) {
+	result, err := circuitbreaker.MinIO.Execute(func() (interface{}, error) {
+		object, err := client.GetObject(context.Background(), cfg.MinioBucketName, jobRecordPath(videoID), minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+		data, err := io.ReadAll(object)
+		if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, joberrors.Permanent(joberrors.CodeNotFound, fmt.Errorf("job record %s: %w", videoID, fs.ErrNotExist))
+		}
+		return data, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived job record: %w", err)
+	}
+	return result.([]byte), nil
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// JobArchive durably stores the final state of jobs, which outlives the Redis
+// key (jobTTL). GetJobRecord must return an error wrapping fs.ErrNotExist when
+// no record exists for videoID.
+type JobArchive interface {
+	PutJobRecord(videoID string, data []byte) error
+	GetJobRecord(videoID string) ([]byte, error)
+}
+
+// archive is nil unless SetJobArchive was called; terminal states are then only kept in Redis.
+var archive JobArchive
+
+// SetJobArchive sets the store terminal job states are archived to.
+func SetJobArchive(a JobArchive) {
+	archive = a
+}
+
+// archiveJob writes the terminal state to the archive. Failures are logged
+// only: Redis keeps the state until it expires, and the next terminal
+// transition (e.g. after a redrive) rewrites the record.
+func archiveJob(videoID string, state JobState) {
+	if archive == nil {
+		return
+	}
+	state.UpdatedAt = time.Now().Unix()
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = archive.PutJobRecord(videoID, data)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Str("status", string(state.Status)).Msg("Failed to archive job state")
+	}
+}
+
+// getArchivedJobState reads the archived state of a job whose Redis key is gone.
+func getArchivedJobState(videoID string) (*JobState, error) {
+	if archive == nil {
+		return nil, ErrJobNotFound
+	}
+	data, err := archive.GetJobRecord(videoID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived job state: %w", err)
+	}
+	return decodeJobState(videoID, data)
+}
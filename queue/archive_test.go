@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+type memoryArchive map[string][]byte
+
+func (m memoryArchive) PutJobRecord(videoID string, data []byte) error {
+	m[videoID] = data
+	return nil
+}
+
+func (m memoryArchive) GetJobRecord(videoID string) ([]byte, error) {
+	data, ok := m[videoID]
+	if !ok {
+		return nil, fmt.Errorf("job record %s: %w", videoID, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+func TestArchiveJob_RoundTrip(t *testing.T) {
+	prev := archive
+	defer func() { archive = prev }()
+
+	store := memoryArchive{}
+	SetJobArchive(store)
+	archiveJob("v1", JobState{Status: JobStatusDone, RetryCount: 1})
+
+	state, err := getArchivedJobState("v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.VideoID != "v1" || state.Status != JobStatusDone || state.RetryCount != 1 || state.UpdatedAt == 0 {
+		t.Errorf("unexpected archived state %+v", state)
+	}
+
+	if _, err := getArchivedJobState("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound for a missing record, got %v", err)
+	}
+}
+
+func TestGetArchivedJobState_NoArchive(t *testing.T) {
+	prev := archive
+	defer func() { archive = prev }()
+
+	SetJobArchive(nil)
+	archiveJob("v1", JobState{Status: JobStatusDone})
+	if _, err := getArchivedJobState("v1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound without an archive, got %v", err)
+	}
+}
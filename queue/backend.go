@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Queue backends selectable via QUEUE_BACKEND.
+const (
+	BackendList    = "list"
+	BackendStreams = "streams"
+)
+
+// Backend abstracts the Redis data structure that delivers jobs to workers.
+// Job state (job:<videoID>), the dead letter queue and the success queue are
+// independent of the backend and always use plain keys/lists.
+type Backend interface {
+	// Publish appends payload to queue.
+	Publish(ctx context.Context, queue, payload string) error
+	// Consume takes the next message from queue. A negative timeout does not block,
+	// zero blocks until a message arrives or ctx is canceled, and a positive timeout
+	// blocks at most that long. Returns (nil, nil) when no message was available.
+	// The message stays in flight until Ack or Reclaim.
+	Consume(ctx context.Context, queue string, timeout time.Duration) (*Message, error)
+	// Ack marks msg as finished so it is no longer considered in flight.
+	Ack(ctx context.Context, msg *Message) error
+	// Len returns the number of messages waiting in queue (excluding in-flight ones).
+	Len(ctx context.Context, queue string) (int64, error)
+	// InFlight returns the messages owned by some consumer, candidates for recovery.
+	// Backends that track delivery time only return those in flight for at least minIdle.
+	InFlight(ctx context.Context, minIdle time.Duration) ([]*Message, error)
+	// Reclaim removes an in-flight message from the in-flight set so the caller can
+	// publish it again. Returns false if the message was already acknowledged or
+	// reclaimed elsewhere.
+	Reclaim(ctx context.Context, msg *Message) (bool, error)
+	// Remove deletes waiting messages equal to payload from queue and returns how
+	// many were removed. Used to cancel jobs that have not been consumed yet.
+	Remove(ctx context.Context, queue, payload string) (int64, error)
+}
+
+func newBackend(name string) (Backend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", BackendList:
+		return &listBackend{}, nil
+	case BackendStreams:
+		return newStreamBackend(cfg.RedisStreamGroup, instanceID), nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q (expected %q or %q)", name, BackendList, BackendStreams)
+	}
+}
+
+// strandedJobs counts the jobs the other backend still holds: its waiting and
+// in-flight messages would never be consumed once the workers switched to b.
+func strandedJobs(ctx context.Context, b Backend) (int64, error) {
+	queues, err := consumedQueues(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, queue := range queues {
+		var n int64
+		switch b.(type) {
+		case *streamBackend:
+			n, err = client.LLen(ctx, queue).Result()
+		default:
+			n, err = client.XLen(ctx, streamKey(queue)).Result()
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	if _, ok := b.(*streamBackend); ok {
+		n, err := client.LLen(ctx, processingQueueName()).Result()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// consumedQueues returns the queues workers consume from, highest priority first:
+// for each priority, the shared queue followed by the sub-queue of every registered tenant.
+func consumedQueues(ctx context.Context) ([]string, error) {
+	all, err := tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]string, 0, len(priorities)*len(all))
+	for _, p := range priorities {
+		for _, tenant := range all {
+			queues = append(queues, jobQueue(p, tenant))
+		}
+	}
+	return queues, nil
+}
@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	cancelKeyPrefix = "cancel:"
+
+	// cancelPollInterval is how often running jobs are checked against cancel markers,
+	// covering pub/sub messages lost while the subscription was reconnecting.
+	cancelPollInterval = 5 * time.Second
+)
+
+var (
+	// ErrJobCancelled is the cancellation cause of a job context stopped by CancelJob.
+	ErrJobCancelled = errors.New("job cancelled")
+	// ErrJobNotCancellable is returned by CancelJob for jobs that already finished.
+	ErrJobNotCancellable = errors.New("job already finished")
+)
+
+// running maps the videoIDs processed by this instance to the cancel function of their context.
+var (
+	runningMu sync.Mutex
+	running   = map[string]context.CancelCauseFunc{}
+)
+
+func cancelKey(videoID string) string {
+	return cancelKeyPrefix + videoID
+}
+
+// cancelChannel is the pub/sub channel used to reach the worker that owns a job.
+func cancelChannel() string {
+	return queueKey(cfg.ProcessingRequestQueue, "cancel")
+}
+
+// CancelJob stops a job. A cancel marker is always recorded so a worker that
+// consumes the job concurrently drops it. Jobs still waiting in a queue (or in
+// the delayed retry set) are removed and marked cancelled right away; jobs being
+// processed are signalled to their worker, which cancels the pipeline and marks
+// them cancelled once cleanup is done. The returned state tells which happened.
+// Returns ErrJobNotFound or ErrJobNotCancellable when there is nothing to cancel.
+func CancelJob(videoID string) (*JobState, error) {
+	state, err := GetJobState(videoID)
+	if err != nil {
+		return nil, err
+	}
+	switch state.Status {
+	case JobStatusDone, JobStatusFailed, JobStatusCancelled, JobStatusExpired:
+		return state, ErrJobNotCancellable
+	}
+
+	ctx := context.Background()
+	if err := client.Set(ctx, cancelKey(videoID), "1", jobTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to record cancellation: %w", err)
+	}
+
+	if state.Status == JobStatusPending {
+		removed, err := removeWaitingJob(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		if removed > 0 {
+			log.Info().Str("videoID", videoID).Msg("Pending job cancelled")
+			return SetJobCancelled(videoID)
+		}
+	}
+
+	// In flight, or consumed between GetJobState and removal: reach the owner.
+	if err := client.Publish(ctx, cancelChannel(), videoID).Err(); err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to signal cancellation, worker will pick up the marker")
+	}
+	log.Info().Str("videoID", videoID).Msg("Cancellation requested for in-flight job")
+	return state, nil
+}
+
+// removeWaitingJob removes the job's payload from its request queue and the delayed set.
+func removeWaitingJob(ctx context.Context, state *JobState) (int64, error) {
+	payload := state.VideoID
+	if state.Spec != nil {
+		encoded, err := encodeJobSpec(state.Spec)
+		if err != nil {
+			return 0, err
+		}
+		payload = encoded
+	}
+	removed, err := backend.Remove(ctx, jobQueue(state.Priority, state.Tenant()), payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove job from queue: %w", err)
+	}
+	delayed, err := client.ZRem(ctx, delayedQueueName(), payload).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove job from delayed retries: %w", err)
+	}
+	return removed + delayed, nil
+}
+
+// SetJobCancelled updates the job state to cancelled, archives it and clears the cancel marker.
+func SetJobCancelled(videoID string) (*JobState, error) {
+	existing, _ := getLiveJobState(videoID)
+	if existing == nil {
+		existing = &JobState{VideoID: videoID, CreatedAt: time.Now().Unix()}
+	}
+	existing.Status = JobStatusCancelled
+	existing.Error = ""
+	existing.ErrorCode = ""
+	existing.NextAttemptAt = 0
+	if err := setJobState(videoID, *existing); err != nil {
+		return nil, err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventCancelled, Status: JobStatusCancelled})
+	archiveJob(videoID, *existing)
+	if err := client.Del(context.Background(), cancelKey(videoID)).Err(); err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to clear cancel marker")
+	}
+	return existing, nil
+}
+
+// CancelRequested reports whether CancelJob was called for a job that has not finished yet.
+func CancelRequested(videoID string) bool {
+	n, err := client.Exists(context.Background(), cancelKey(videoID)).Result()
+	return err == nil && n > 0
+}
+
+// WatchCancellation returns a context that is cancelled with ErrJobCancelled
+// when CancelJob is called for videoID. release must be called when the job ends.
+// Requires StartCancelListener to be running.
+func WatchCancellation(parent context.Context, videoID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	runningMu.Lock()
+	running[videoID] = cancel
+	runningMu.Unlock()
+
+	return ctx, func() {
+		runningMu.Lock()
+		delete(running, videoID)
+		runningMu.Unlock()
+		cancel(nil)
+	}
+}
+
+func cancelRunning(videoID string) {
+	runningMu.Lock()
+	cancel, ok := running[videoID]
+	runningMu.Unlock()
+	if ok {
+		log.Info().Str("videoID", videoID).Msg("Cancelling running job")
+		cancel(ErrJobCancelled)
+	}
+}
+
+// StartCancelListener delivers cancellation requests to the jobs running on this
+// instance: via pub/sub for immediate delivery, and by polling the cancel markers
+// of running jobs in case a message was missed.
+func StartCancelListener(ctx context.Context) {
+	sub := client.Subscribe(ctx, cancelChannel())
+	defer sub.Close()
+	messages := sub.Channel()
+
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	log.Info().Str("channel", cancelChannel()).Msg("Job cancellation listener started")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			cancelRunning(msg.Payload)
+		case <-ticker.C:
+			checkCancelMarkers(ctx)
+		}
+	}
+}
+
+func checkCancelMarkers(ctx context.Context) {
+	runningMu.Lock()
+	videoIDs := make([]string, 0, len(running))
+	for videoID := range running {
+		videoIDs = append(videoIDs, videoID)
+	}
+	runningMu.Unlock()
+
+	for _, videoID := range videoIDs {
+		n, err := client.Exists(ctx, cancelKey(videoID)).Result()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to check cancel markers")
+			return
+		}
+		if n > 0 {
+			cancelRunning(videoID)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWatchCancellation(t *testing.T) {
+	ctx, release := WatchCancellation(context.Background(), "v1")
+	defer release()
+
+	cancelRunning("other")
+	if ctx.Err() != nil {
+		t.Fatal("expected context to stay active when another job is cancelled")
+	}
+
+	cancelRunning("v1")
+	<-ctx.Done()
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrJobCancelled) {
+		t.Errorf("expected cause ErrJobCancelled, got %v", cause)
+	}
+}
+
+func TestWatchCancellation_Release(t *testing.T) {
+	ctx, release := WatchCancellation(context.Background(), "v2")
+	release()
+
+	if _, ok := running["v2"]; ok {
+		t.Error("expected released job to be unregistered")
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, ErrJobCancelled) {
+		t.Error("expected release not to report a cancellation")
+	}
+}
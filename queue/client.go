@@ -2,64 +2,188 @@ package queue
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 	"video-processor/config"
 	"video-processor/internal/circuitbreaker"
+	"video-processor/internal/joberrors"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 )
 
 var (
-	client *redis.Client
-	cfg    *config.Config
+	client  redis.UniversalClient
+	cfg     *config.Config
+	backend Backend
+
+	// instanceID identifies this worker process (hostname-pid); used as stream consumer name.
+	instanceID string
 )
 
+// Message is a job delivered to a worker.
 type Message struct {
 	VideoID string
+	// Spec is the decoded job spec (a bare videoID decodes to a version 0 spec).
+	Spec *JobSpec
+	// Payload is the raw message as stored by the backend.
+	Payload string
+	// Queue is the queue the message was published to (empty if unknown).
+	Queue string
+	// ID is the backend delivery ID (stream entry ID); empty for the list backend.
+	ID string
+	// DeliveryCount is how many times the message has been delivered (streams only).
+	DeliveryCount int64
 }
 
 func InitRedisClient(configs *config.Config) {
 	cfg = configs
 
-	client = redis.NewClient(&redis.Options{
-		Addr: cfg.RedisHost,
-	})
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid Redis configuration")
+	}
+	client = redis.NewUniversalClient(opts)
 
 	if err := client.Ping(context.Background()).Err(); err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect Redis client")
 	}
-	log.Info().Str("host", cfg.RedisHost).Msg("Redis client connected successfully")
+	log.Info().
+		Str("host", cfg.RedisHost).
+		Str("mode", cfg.RedisMode).
+		Bool("tls", cfg.RedisTLS).
+		Msg("Redis client connected successfully")
+
+	instanceID = newInstanceID()
+	if priorityWeights, err = parsePriorityWeights(cfg.QueuePriorityWeights); err != nil {
+		log.Fatal().Err(err).Msg("Invalid QUEUE_PRIORITY_WEIGHTS")
+	}
+	backend, err = newBackend(cfg.QueueBackend)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize queue backend")
+	}
+	// Switching QUEUE_BACKEND with jobs still on the other backend would strand them.
+	if stranded, err := strandedJobs(context.Background(), backend); err != nil {
+		log.Fatal().Err(err).Msg("Failed to check the other queue backend for jobs")
+	} else if stranded > 0 {
+		log.Fatal().
+			Int64("jobs", stranded).
+			Str("backend", cfg.QueueBackend).
+			Msg("Jobs are still queued on the other queue backend: drain them with the previous QUEUE_BACKEND before switching")
+	}
+	log.Info().
+		Str("backend", cfg.QueueBackend).
+		Str("priority_mode", cfg.QueuePriorityMode).
+		Str("instance", instanceID).
+		Msg("Queue backend initialized")
+}
+
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// InstanceID returns the identifier of this worker process.
+func InstanceID() string {
+	return instanceID
 }
 
 func processingQueueName() string {
-	return cfg.ProcessingRequestQueue + ":processing"
+	return queueKey(cfg.ProcessingRequestQueue, "processing")
 }
 
 func deadLetterQueueName() string {
-	return cfg.ProcessingRequestQueue + ":dead"
+	return queueKey(cfg.ProcessingRequestQueue, "dead")
 }
 
-// ConsumeMessage blocks until a message is received from the queue or ctx is canceled.
-// Uses BRPOPLPUSH to atomically move the job to the processing queue.
+// consumeWaitTimeout is how long ConsumeMessage blocks on the first queue of the
+// polling order when all request queues are empty, before polling them again.
+const consumeWaitTimeout = time.Second
+
+// ConsumeMessage blocks until a message is received from one of the request queues or ctx is canceled.
+// Priorities are polled in the order given by QUEUE_PRIORITY_MODE (strict or weighted); within a
+// priority, tenants are polled round-robin starting after the tenant this process served last,
+// so a tenant with a large backlog gets one job per turn like everyone else.
+// The backend keeps the message in flight (processing list or stream PEL) until acknowledged.
 func ConsumeMessage(ctx context.Context) (*Message, error) {
-	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
-		videoID, err := client.BRPopLPush(ctx, cfg.ProcessingRequestQueue, processingQueueName(), 0).Result()
+	for {
+		all, err := tenants(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return &Message{VideoID: videoID}, nil
+		order := nextPriorityOrder()
+		for _, p := range order {
+			for _, tenant := range rotation.order(p, all) {
+				msg, err := consumeFrom(ctx, jobQueue(p, tenant), -1)
+				if err != nil {
+					return nil, err
+				}
+				if msg != nil {
+					rotation.served(p, tenant)
+					return msg, nil
+				}
+			}
+		}
+		// Only the shared queue can be blocked on; jobs arriving on the other
+		// queues are picked up by the next pass, at most consumeWaitTimeout later.
+		msg, err := consumeFrom(ctx, queueForPriority(order[0]), consumeWaitTimeout)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// consumeFrom takes one message from queue and decodes its job spec.
+// Malformed messages are moved to the dead letter queue and reported as no message.
+func consumeFrom(ctx context.Context, queue string, timeout time.Duration) (*Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return backend.Consume(ctx, queue, timeout)
 	})
 	if err != nil {
 		return nil, err
 	}
-	return result.(*Message), nil
+	msg := result.(*Message)
+	if msg == nil {
+		return nil, nil
+	}
+	if err := decodeMessage(msg); err != nil {
+		log.Error().Err(err).Str("queue", queue).Str("payload", msg.Payload).Msg("Discarding malformed job message")
+		if err := client.LPush(ctx, deadLetterQueueName(), msg.Payload).Err(); err != nil {
+			log.Warn().Err(err).Msg("Failed to move malformed message to dead letter queue")
+		}
+		if err := backend.Ack(ctx, msg); err != nil {
+			log.Warn().Err(err).Msg("Failed to acknowledge malformed message")
+		}
+		return nil, nil
+	}
+	return msg, nil
+}
+
+// decodeMessage parses msg.Payload and fills Spec and VideoID.
+func decodeMessage(msg *Message) error {
+	spec, err := ParseJobSpec(msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Spec = spec
+	msg.VideoID = spec.VideoID
+	return nil
 }
 
-// AcknowledgeMessage removes the job from the processing queue after completion (success or failure).
-func AcknowledgeMessage(videoID string) error {
+// AcknowledgeMessage removes the job from the in-flight set after completion (success or failure).
+func AcknowledgeMessage(msg *Message) error {
 	_, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
-		return nil, client.LRem(context.Background(), processingQueueName(), 1, videoID).Err()
+		return nil, backend.Ack(context.Background(), msg)
 	})
 	return err
 }
@@ -68,58 +192,158 @@ func PublishSuccessMessage(videoID string) error {
 	_, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
 		return nil, client.LPush(context.Background(), cfg.ProcessingFinishedQueue, videoID).Err()
 	})
-	return err
+	return joberrors.Transient(joberrors.CodeTransientIO, err)
 }
 
-// StartRecovery starts a goroutine that periodically checks the processing queue
-// and re-queues stuck jobs (worker crash) back to the main queue.
-func StartRecovery(ctx context.Context, stuckTimeout time.Duration) {
-	ticker := time.NewTicker(time.Minute)
+// StartRecovery starts a goroutine that periodically checks the in-flight jobs
+// and re-queues stuck jobs (worker crash) back to the main queue. A job that
+// exhausted MaxJobRetries is moved to the dead letter queue instead and passed
+// to onDeadLetter (may be nil) with its final state.
+func StartRecovery(ctx context.Context, onDeadLetter func(state *JobState)) {
+	leaseTTL := jobLeaseTTL()
+	ticker := time.NewTicker(leaseTTL)
 	defer ticker.Stop()
-	log.Info().Dur("stuck_timeout", stuckTimeout).Msg("Orphan job recovery started")
+	log.Info().Dur("lease_ttl", leaseTTL).Msg("Orphan job recovery started")
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			recoverStuckJobs(stuckTimeout)
+			recoverStuckJobs(leaseTTL, onDeadLetter)
+			pruneIdleTenants(ctx)
 		}
 	}
 }
 
-func recoverStuckJobs(stuckTimeout time.Duration) {
-	videoIDs, err := client.LRange(context.Background(), processingQueueName(), 0, -1).Result()
+// recoverStuckJobs requeues in-flight jobs whose lease expired, i.e. whose
+// worker stopped heartbeating. Jobs still holding a lease are never touched,
+// however long they run. Each recovery consumes a retry, so a video that kills
+// its worker every time ends in the dead letter queue like any failing job.
+func recoverStuckJobs(leaseTTL time.Duration, onDeadLetter func(state *JobState)) {
+	ctx := context.Background()
+	msgs, err := backend.InFlight(ctx, leaseTTL)
 	if err != nil {
-		log.Warn().Err(err).Msg("Failed to check processing queue for recovery")
+		log.Warn().Err(err).Msg("Failed to check in-flight jobs for recovery")
 		return
 	}
 
-	threshold := time.Now().Add(-stuckTimeout).Unix()
-	for _, videoID := range videoIDs {
-		state, err := GetJobState(videoID)
+	for _, msg := range msgs {
+		if err := decodeMessage(msg); err != nil {
+			log.Warn().Err(err).Str("payload", msg.Payload).Msg("Skipping malformed in-flight message during recovery")
+			continue
+		}
+		videoID := msg.VideoID
+		state, err := getLiveJobState(videoID)
 		if err != nil || state == nil {
 			continue
 		}
-		if state.Status != JobStatusProcessing || state.UpdatedAt >= threshold {
+		// The lease is acquired before the state moves to processing,
+		// so a processing job without a lease has lost its worker.
+		if state.Status != JobStatusProcessing {
+			continue
+		}
+		held, err := leaseHeld(ctx, videoID)
+		if err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to check job lease")
+			continue
+		}
+		if held {
+			continue
+		}
+
+		reclaimed, err := backend.Reclaim(ctx, msg)
+		if err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to reclaim orphan job")
 			continue
 		}
+		if !reclaimed {
+			continue // acknowledged or recovered by another instance in the meantime
+		}
 
-		log.Warn().Str("videoID", videoID).Int("retry_count", state.RetryCount).Msg("Orphan job detected, re-queuing")
+		owner := ""
+		if state.Owner != nil {
+			owner = state.Owner.String()
+		}
+		log.Warn().
+			Str("videoID", videoID).
+			Str("owner", owner).
+			Int("retry_count", state.RetryCount).
+			Msg("Job lease expired")
 
+		lostOwner, attempt := state.Owner, state.Attempt()
 		state.RetryCount++
+		state.Owner = nil
+		if state.RetryCount > MaxJobRetries {
+			deadLetterOrphan(ctx, msg, state, lostOwner, attempt, onDeadLetter)
+			continue
+		}
 		state.Status = JobStatusPending
 		if err := setJobState(videoID, *state); err != nil {
 			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update state during recovery")
-			continue
 		}
-		client.LRem(context.Background(), processingQueueName(), 1, videoID)
-		client.LPush(context.Background(), cfg.ProcessingRequestQueue, videoID)
+		appendJobEvent(videoID, JobEvent{Type: EventLeaseExpired, Status: JobStatusPending, Attempt: attempt, Owner: lostOwner})
+		if err := publishToQueue(ctx, state.Priority, state.Tenant(), msg.Payload); err != nil {
+			log.Error().Err(err).Str("videoID", videoID).Msg("Failed to re-queue orphan job")
+		}
 	}
 }
 
-// GetQueueSize returns the number of jobs waiting in the request queue.
+// deadLetterOrphan fails a reclaimed job that exhausted its retries and moves it to
+// the dead letter queue. If that fails it is requeued rather than lost, since the
+// message has already left the in-flight set.
+func deadLetterOrphan(ctx context.Context, msg *Message, state *JobState, lostOwner *JobOwner, attempt int, onDeadLetter func(state *JobState)) {
+	videoID := msg.VideoID
+	state.Status = JobStatusFailed
+	state.Error = fmt.Sprintf("%s on every attempt", ErrLeaseLost)
+	state.ErrorCode = joberrors.CodeUnknown
+	if err := setJobState(videoID, *state); err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update state during recovery")
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventLeaseExpired, Status: JobStatusFailed, Attempt: attempt, Owner: lostOwner, Error: state.Error, ErrorCode: state.ErrorCode})
+	if err := MoveToDLQ(msg.Spec); err != nil {
+		log.Error().Err(err).Str("videoID", videoID).Msg("Failed to move orphan job to dead letter queue, re-queuing it")
+		if err := publishToQueue(ctx, state.Priority, state.Tenant(), msg.Payload); err != nil {
+			log.Error().Err(err).Str("videoID", videoID).Msg("Failed to re-queue orphan job")
+		}
+		return
+	}
+	log.Error().Str("videoID", videoID).Int("retry_count", state.RetryCount).Msg("Job lease expired on its last attempt, moved to dead letter queue")
+	if onDeadLetter != nil {
+		onDeadLetter(state)
+	}
+}
+
+// GetQueueSize returns the number of jobs waiting across all request queues.
 func GetQueueSize() (int64, error) {
-	return client.LLen(context.Background(), cfg.ProcessingRequestQueue).Result()
+	sizes, err := GetQueueSizes()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return total, nil
+}
+
+// GetQueueSizes returns the number of jobs waiting per priority, summed over tenants.
+func GetQueueSizes() (map[Priority]int64, error) {
+	ctx := context.Background()
+	all, err := tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[Priority]int64, len(priorities))
+	for _, p := range priorities {
+		for _, tenant := range all {
+			size, err := backend.Len(ctx, jobQueue(p, tenant))
+			if err != nil {
+				return nil, err
+			}
+			sizes[p] += size
+		}
+	}
+	return sizes, nil
 }
 
 // HealthCheck checks whether the Redis client is healthy.
@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"video-processor/internal/circuitbreaker"
+)
+
+// DLQEntry is a dead-lettered job together with its last recorded state.
+type DLQEntry struct {
+	// ID identifies the entry for redrive/purge: the videoID, or the raw payload
+	// for malformed messages that could not be parsed.
+	ID         string `json:"id"`
+	VideoID    string `json:"video_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	RetryCount int    `json:"retry_count"`
+	UpdatedAt  int64  `json:"updated_at,omitempty"`
+	// Spec is the job as it was dead-lettered (a bare spec for legacy entries).
+	Spec *JobSpec `json:"spec,omitempty"`
+	// Malformed is true for payloads that were dead-lettered because they could not be parsed.
+	Malformed bool `json:"malformed,omitempty"`
+}
+
+// GetDLQSize returns the number of entries in the dead letter queue.
+func GetDLQSize() (int64, error) {
+	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return client.LLen(context.Background(), deadLetterQueueName()).Result()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// ListDLQ returns up to limit entries of the dead letter queue starting at offset
+// (newest first), enriched with the error and retry count from the job state.
+func ListDLQ(offset, limit int64) ([]DLQEntry, error) {
+	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return client.LRange(context.Background(), deadLetterQueueName(), offset, offset+limit-1).Result()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter queue: %w", err)
+	}
+
+	raw := result.([]string)
+	entries := make([]DLQEntry, 0, len(raw))
+	for _, payload := range raw {
+		entries = append(entries, dlqEntry(payload))
+	}
+	return entries, nil
+}
+
+func dlqEntry(payload string) DLQEntry {
+	spec, err := ParseJobSpec(payload)
+	if err != nil {
+		return DLQEntry{ID: payload, Error: err.Error(), Malformed: true}
+	}
+	entry := DLQEntry{ID: spec.VideoID, VideoID: spec.VideoID, Spec: spec}
+	if state, err := GetJobState(spec.VideoID); err == nil {
+		entry.Error = state.Error
+		entry.RetryCount = state.RetryCount
+		entry.UpdatedAt = state.UpdatedAt
+	}
+	return entry
+}
+
+// dlqPayloads returns the dead letter entries selected by ids (entry IDs, see
+// DLQEntry), or every entry if ids is empty.
+func dlqPayloads(ctx context.Context, ids []string) ([]string, error) {
+	all, err := client.LRange(ctx, deadLetterQueueName(), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letter queue: %w", err)
+	}
+	if len(ids) == 0 {
+		return all, nil
+	}
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	var payloads []string
+	for _, payload := range all {
+		if selected[dlqEntryID(payload)] {
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads, nil
+}
+
+// dlqEntryID returns the videoID of a dead letter payload, or the payload itself if it is malformed.
+func dlqEntryID(payload string) string {
+	if spec, err := ParseJobSpec(payload); err == nil {
+		return spec.VideoID
+	}
+	return payload
+}
+
+// RedriveDLQ moves the given entries (all entries if ids is empty) from the dead
+// letter queue back to the request queue of their priority, resetting RetryCount
+// and Error. Returns the IDs that were redriven; IDs not found in the DLQ and
+// malformed entries are skipped, and entries whose job is pending or processing
+// again (resubmitted, or redriven twice) stay in the DLQ.
+func RedriveDLQ(ids []string) ([]string, error) {
+	ctx := context.Background()
+	payloads, err := dlqPayloads(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	redriven := []string{}
+	for _, payload := range payloads {
+		spec, err := ParseJobSpec(payload)
+		if err != nil {
+			log.Warn().Err(err).Str("id", payload).Msg("Skipping malformed dead letter entry")
+			continue
+		}
+		removed, err := client.LRem(ctx, deadLetterQueueName(), 1, payload).Result()
+		if err != nil {
+			return redriven, fmt.Errorf("failed to remove %s from dead letter queue: %w", spec.VideoID, err)
+		}
+		if removed == 0 {
+			continue
+		}
+		if err := redriveJob(ctx, spec); err != nil {
+			// Put it back so the entry is not lost.
+			client.LPush(ctx, deadLetterQueueName(), payload)
+			if errors.Is(err, ErrJobActive) {
+				log.Warn().Err(err).Str("videoID", spec.VideoID).Msg("Skipping dead letter entry of an active job")
+				continue
+			}
+			return redriven, fmt.Errorf("failed to redrive %s: %w", spec.VideoID, err)
+		}
+		log.Info().Str("videoID", spec.VideoID).Msg("Job redriven from dead letter queue")
+		redriven = append(redriven, spec.VideoID)
+	}
+	return redriven, nil
+}
+
+// redriveJob resets the job state and publishes its spec again: the persisted
+// one, else the spec of the dead letter entry. If the state already expired,
+// the entry spec is published as a new job. Like PublishJob, it claims the job
+// and returns ErrJobActive if it is pending or processing.
+func redriveJob(ctx context.Context, spec *JobSpec) error {
+	videoID := spec.VideoID
+	state, err := getLiveJobState(videoID)
+	if errors.Is(err, ErrJobNotFound) {
+		return PublishJob(*spec)
+	}
+	if err != nil {
+		return err
+	}
+
+	if state.Spec == nil {
+		state.Spec = spec
+	}
+	if state.Priority == "" {
+		state.Priority = spec.Priority
+	}
+	payload, err := encodeJobSpec(state.Spec)
+	if err != nil {
+		return err
+	}
+	state.Status = JobStatusPending
+	state.RetryCount = 0
+	state.Error = ""
+	state.ErrorCode = ""
+	state.NextAttemptAt = 0
+	unclaim, err := claimJob(videoID, *state)
+	if err != nil {
+		return err
+	}
+	if err := publishToQueue(ctx, state.Priority, state.Tenant(), payload); err != nil {
+		unclaim()
+		return err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventRedriven, Status: JobStatusPending, Attempt: state.Attempt()})
+	return nil
+}
+
+// PurgeDLQ deletes the given entries (all entries if ids is empty) from the dead
+// letter queue. Job states are left to expire with their TTL. Returns the number
+// of entries removed.
+func PurgeDLQ(ids []string) (int64, error) {
+	ctx := context.Background()
+	if len(ids) == 0 {
+		size, err := client.LLen(ctx, deadLetterQueueName()).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read dead letter queue: %w", err)
+		}
+		if err := client.Del(ctx, deadLetterQueueName()).Err(); err != nil {
+			return 0, fmt.Errorf("failed to purge dead letter queue: %w", err)
+		}
+		log.Warn().Int64("count", size).Msg("Dead letter queue purged")
+		return size, nil
+	}
+
+	payloads, err := dlqPayloads(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	var purged int64
+	for _, payload := range payloads {
+		removed, err := client.LRem(ctx, deadLetterQueueName(), 1, payload).Result()
+		if err != nil {
+			return purged, fmt.Errorf("failed to remove %s from dead letter queue: %w", dlqEntryID(payload), err)
+		}
+		purged += removed
+	}
+	log.Warn().Int64("count", purged).Strs("ids", ids).Msg("Entries purged from dead letter queue")
+	return purged, nil
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"video-processor/internal/joberrors"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	eventsKeyPrefix = "events:"
+
+	// maxJobEvents bounds the history of a single job; the oldest events are dropped first.
+	maxJobEvents = 500
+)
+
+// JobEventType classifies an entry of the job history.
+type JobEventType string
+
+const (
+	EventSubmitted      JobEventType = "submitted"
+	EventStarted        JobEventType = "started"
+	EventStepFinished   JobEventType = "step_finished"
+	EventSucceeded      JobEventType = "succeeded"
+	EventFailed         JobEventType = "failed"
+	EventRetryScheduled JobEventType = "retry_scheduled"
+	EventRequeued       JobEventType = "requeued"
+	EventLeaseExpired   JobEventType = "lease_expired"
+	EventDeadLettered   JobEventType = "dead_lettered"
+	EventRedriven       JobEventType = "redriven"
+	EventCancelled      JobEventType = "cancelled"
+	EventExpired        JobEventType = "expired"
+)
+
+// JobEvent is one entry of the append-only job history.
+type JobEvent struct {
+	Type JobEventType `json:"type"`
+	// Status is the job status after the event (empty for step events).
+	Status JobStatus `json:"status,omitempty"`
+	// Attempt is the 1-based processing attempt the event belongs to.
+	Attempt int       `json:"attempt,omitempty"`
+	Owner   *JobOwner `json:"owner,omitempty"`
+	Step    string    `json:"step,omitempty"`
+	// DurationMs is the step duration for step events.
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// ErrorCode is set on failed events (see internal/joberrors).
+	ErrorCode joberrors.Code `json:"error_code,omitempty"`
+	// NextAttemptAt is set on retry_scheduled events (unix seconds).
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+	Timestamp     int64 `json:"timestamp"`
+}
+
+func eventsKey(videoID string) string {
+	return eventsKeyPrefix + videoID
+}
+
+// appendJobEvent records event in the history of videoID. The history shares the
+// state's TTL. Failures are only logged: history must never fail a job.
+func appendJobEvent(videoID string, event JobEvent) {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to serialize job event")
+		return
+	}
+
+	ctx := context.Background()
+	key := eventsKey(videoID)
+	pipe := client.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -maxJobEvents, -1)
+	pipe.Expire(ctx, key, jobTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("videoID", videoID).Str("event", string(event.Type)).Msg("Failed to record job event")
+	}
+}
+
+// RecordStepEvent records the duration and outcome of a pipeline step.
+func RecordStepEvent(videoID string, attempt int, owner JobOwner, step string, duration time.Duration, stepErr error) {
+	event := JobEvent{
+		Type:       EventStepFinished,
+		Attempt:    attempt,
+		Owner:      &owner,
+		Step:       step,
+		DurationMs: duration.Milliseconds(),
+	}
+	if stepErr != nil {
+		event.Error = stepErr.Error()
+	}
+	appendJobEvent(videoID, event)
+}
+
+// GetJobEvents returns the history of a job, oldest first.
+func GetJobEvents(videoID string) ([]JobEvent, error) {
+	raw, err := client.LRange(context.Background(), eventsKey(videoID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+	events := make([]JobEvent, 0, len(raw))
+	for _, data := range raw {
+		var event JobEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to deserialize job event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrJobExpired is the cancellation cause of a job context stopped at the job deadline.
+var ErrJobExpired = errors.New("job expired")
+
+// Deadline returns the time the job expires; ok is false if it has no deadline.
+func (s *JobSpec) Deadline() (deadline time.Time, ok bool) {
+	if s == nil || s.ExpiresAt == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(s.ExpiresAt, 0), true
+}
+
+// Expired reports whether the job deadline has passed at now.
+func (s *JobSpec) Expired(now time.Time) bool {
+	deadline, ok := s.Deadline()
+	return ok && !now.Before(deadline)
+}
+
+// SetJobExpired updates the job state to expired, a terminal state: the job
+// reached its deadline before it could complete, and is not retried.
+func SetJobExpired(videoID string) (*JobState, error) {
+	existing, _ := getLiveJobState(videoID)
+	if existing == nil {
+		existing = &JobState{VideoID: videoID, CreatedAt: time.Now().Unix()}
+	}
+	existing.Status = JobStatusExpired
+	existing.Error = ""
+	existing.ErrorCode = ""
+	existing.NextAttemptAt = 0
+	if err := setJobState(videoID, *existing); err != nil {
+		return nil, err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventExpired, Status: JobStatusExpired, Attempt: existing.Attempt()})
+	archiveJob(videoID, *existing)
+	return existing, nil
+}
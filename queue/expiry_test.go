@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobSpec_Expired(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	if (&JobSpec{VideoID: "v1"}).Expired(now) {
+		t.Error("expected a spec without deadline never to expire")
+	}
+	var missing *JobSpec
+	if missing.Expired(now) {
+		t.Error("expected a nil spec never to expire")
+	}
+
+	spec := &JobSpec{VideoID: "v1", ExpiresAt: now.Unix()}
+	if deadline, ok := spec.Deadline(); !ok || !deadline.Equal(now) {
+		t.Errorf("expected deadline %v, got %v (ok: %v)", now, deadline, ok)
+	}
+	if spec.Expired(now.Add(-time.Second)) {
+		t.Error("expected the job to be live before its deadline")
+	}
+	if !spec.Expired(now) {
+		t.Error("expected the job to be expired at its deadline")
+	}
+}
+
+func TestParseJobSpec_KeepsExpiredJobs(t *testing.T) {
+	// Expiry is decided by the consumer; the payload must still parse so the
+	// job can be marked expired instead of dead-lettered as malformed.
+	spec, err := ParseJobSpec(`{"version":1,"video_id":"v1","expires_at":1000}`)
+	if err != nil {
+		t.Fatalf("ParseJobSpec() failed: %v", err)
+	}
+	if !spec.Expired(time.Now()) {
+		t.Error("expected the parsed spec to be expired")
+	}
+}
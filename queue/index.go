@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-processor/internal/circuitbreaker"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidCursor is returned by ListJobs for a cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// statusIndexKey returns the sorted set indexing the jobs in status, scored by
+// JobState.UpdatedAt. The keys share a hash tag so a transition can move a job
+// between indexes in one MULTI, even in cluster mode.
+func statusIndexKey(status JobStatus) string {
+	return queueKey("jobs", "status:"+string(status))
+}
+
+// indexJobState moves videoID to the index of state.Status and drops index
+// entries older than the state TTL, whose job keys have expired.
+func indexJobState(ctx context.Context, videoID string, state JobState) error {
+	pipe := client.TxPipeline()
+	for _, status := range jobStatuses {
+		if status != state.Status {
+			pipe.ZRem(ctx, statusIndexKey(status), videoID)
+		}
+	}
+	key := statusIndexKey(state.Status)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(state.UpdatedAt), Member: videoID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(time.Now().Add(-jobTTL).Unix(), 10))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update job status index: %w", err)
+	}
+	return nil
+}
+
+// JobPage is one page of ListJobs. NextCursor is empty on the last page.
+type JobPage struct {
+	Jobs       []JobState `json:"jobs"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// indexEntry is a job position in the listing order: newest UpdatedAt first,
+// ties broken by descending videoID (the order of ZREVRANGEBYSCORE).
+type indexEntry struct {
+	UpdatedAt int64
+	VideoID   string
+	// Status is the index the entry was read from.
+	Status JobStatus
+}
+
+func (e indexEntry) before(o indexEntry) bool {
+	if e.UpdatedAt != o.UpdatedAt {
+		return e.UpdatedAt > o.UpdatedAt
+	}
+	return e.VideoID > o.VideoID
+}
+
+// The cursor is the position of the last job returned: "<updated_at>:<video_id>".
+func (e indexEntry) cursor() string {
+	return strconv.FormatInt(e.UpdatedAt, 10) + ":" + e.VideoID
+}
+
+func parseCursor(cursor string) (*indexEntry, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	score, videoID, ok := strings.Cut(cursor, ":")
+	updatedAt, err := strconv.ParseInt(score, 10, 64)
+	if !ok || err != nil || videoID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &indexEntry{UpdatedAt: updatedAt, VideoID: videoID}, nil
+}
+
+// ListJobs returns up to limit jobs with the given status (every status when
+// empty) updated at or after since (zero for no bound), newest first. Pass the
+// NextCursor of the previous page to continue; the cursor is a position, so
+// jobs changing status between pages do not shift the remaining results.
+func ListJobs(status JobStatus, since time.Time, cursor string, limit int) (*JobPage, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+	statuses := jobStatuses
+	if status != "" {
+		statuses = []JobStatus{status}
+	}
+	var minScore int64
+	if !since.IsZero() {
+		minScore = since.Unix()
+	}
+
+	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return listJobs(statuses, minScore, after, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*JobPage), nil
+}
+
+func listJobs(statuses []JobStatus, minScore int64, after *indexEntry, limit int) (*JobPage, error) {
+	ctx := context.Background()
+	// Each index yields its own first page; the merged page is the best limit of them.
+	var entries []indexEntry
+	for _, status := range statuses {
+		page, err := indexPage(ctx, status, minScore, after, limit)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].before(entries[b]) })
+	more := len(entries) > limit
+	if more {
+		entries = entries[:limit]
+	}
+
+	page := &JobPage{Jobs: []JobState{}}
+	if len(entries) == 0 {
+		return page, nil
+	}
+	// GETs in a pipeline rather than MGET: job keys live in different cluster slots.
+	pipe := client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(entries))
+	for i, entry := range entries {
+		cmds[i] = pipe.Get(ctx, jobKey(entry.VideoID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to read job states: %w", err)
+	}
+	for i, entry := range entries {
+		data, err := cmds[i].Bytes()
+		if errors.Is(err, redis.Nil) {
+			// Expired job key: drop the stale index entry.
+			client.ZRem(ctx, statusIndexKey(entry.Status), entry.VideoID)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job state %s: %w", entry.VideoID, err)
+		}
+		state, err := decodeJobState(entry.VideoID, data)
+		if err != nil {
+			return nil, err
+		}
+		// The index is updated right after the state; skip a job caught in between.
+		if state.Status != entry.Status {
+			continue
+		}
+		page.Jobs = append(page.Jobs, *state)
+	}
+	if more {
+		page.NextCursor = entries[len(entries)-1].cursor()
+	}
+	return page, nil
+}
+
+// indexPage returns up to limit+1 entries of the status index that come after
+// the cursor position and were updated at or after minScore. The extra entry
+// tells the caller whether another page exists.
+func indexPage(ctx context.Context, status JobStatus, minScore int64, after *indexEntry, limit int) ([]indexEntry, error) {
+	key := statusIndexKey(status)
+	lo := strconv.FormatInt(minScore, 10)
+	hi := "+inf"
+	var entries []indexEntry
+
+	if after != nil {
+		// Jobs sharing the cursor's second come first, in descending videoID order.
+		score := strconv.FormatInt(after.UpdatedAt, 10)
+		ties, err := client.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{Min: score, Max: score}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job status index: %w", err)
+		}
+		for _, videoID := range ties {
+			if after.UpdatedAt >= minScore && videoID < after.VideoID {
+				entries = append(entries, indexEntry{UpdatedAt: after.UpdatedAt, VideoID: videoID, Status: status})
+			}
+		}
+		hi = "(" + score
+	}
+	if len(entries) > limit {
+		return entries[:limit+1], nil
+	}
+
+	rest, err := client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min:   lo,
+		Max:   hi,
+		Count: int64(limit + 1 - len(entries)),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job status index: %w", err)
+	}
+	for _, z := range rest {
+		videoID, _ := z.Member.(string)
+		entries = append(entries, indexEntry{UpdatedAt: int64(z.Score), VideoID: videoID, Status: status})
+	}
+	return entries, nil
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	entry := indexEntry{UpdatedAt: 1712345678, VideoID: "tenant:video-1"}
+
+	parsed, err := parseCursor(entry.cursor())
+	if err != nil {
+		t.Fatalf("parseCursor() failed: %v", err)
+	}
+	if parsed.UpdatedAt != entry.UpdatedAt || parsed.VideoID != entry.VideoID {
+		t.Errorf("expected %+v, got %+v", entry, parsed)
+	}
+	if parsed, err := parseCursor(""); parsed != nil || err != nil {
+		t.Errorf("expected an empty cursor to mean the first page, got %+v, %v", parsed, err)
+	}
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"garbage", "abc:video", "1712345678:", ":video"} {
+		if _, err := parseCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("parseCursor(%q): expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestIndexEntry_Order(t *testing.T) {
+	entries := []indexEntry{
+		{UpdatedAt: 10, VideoID: "a"},
+		{UpdatedAt: 20, VideoID: "b"},
+		{UpdatedAt: 10, VideoID: "c"},
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].before(entries[j]) })
+
+	expected := []string{"b", "c", "a"}
+	for i, e := range entries {
+		if e.VideoID != expected[i] {
+			t.Fatalf("expected order %v, got %+v", expected, entries)
+		}
+	}
+}
@@ -3,8 +3,14 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
+
+	"video-processor/internal/joberrors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 )
 
 // VideoMetadata mirrors the metadata extracted by the pipeline analysis step.
@@ -27,13 +33,69 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusDone       JobStatus = "done"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusCancelled  JobStatus = "cancelled"
+	JobStatusExpired    JobStatus = "expired"
 
 	// MaxJobRetries is the maximum number of retries after the initial attempt.
 	MaxJobRetries = 3
 
 	jobTTL = 24 * time.Hour
+
+	jobKeyPrefix = "job:"
+)
+
+var (
+	// ErrJobNotFound is returned when no state exists for the requested videoID.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobActive is returned by PublishJob when the video already has a pending or processing job.
+	ErrJobActive = errors.New("job already active")
 )
 
+// claimJobScript writes the pending state of a new job (ARGV[1], TTL ARGV[2] ms)
+// unless the current state is pending or processing, so two concurrent
+// submissions of the same video cannot both enqueue it. It returns the status
+// that blocked the claim, or "" once the state is written followed by the state
+// it replaced (nil if none).
+var claimJobScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	local status = cjson.decode(current).status
+	if status == "pending" or status == "processing" then
+		return {status}
+	end
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return {"", current}
+`)
+
+// unclaimJobScript undoes claimJobScript if the state is still the claimed one
+// (ARGV[1]): it restores the replaced state (ARGV[2], TTL ARGV[3] ms), or
+// deletes the key if there was none. Returns 1 if it did.
+var unclaimJobScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == "" then
+	redis.call("DEL", KEYS[1])
+else
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return 1
+`)
+
+// jobStatuses lists every known job status; each has its own status index.
+var jobStatuses = []JobStatus{JobStatusPending, JobStatusProcessing, JobStatusDone, JobStatusFailed, JobStatusCancelled, JobStatusExpired}
+
+// ValidJobStatus reports whether status is one of the known job statuses.
+func ValidJobStatus(status JobStatus) bool {
+	for _, s := range jobStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // JobArtifacts contains the paths of the artifacts generated in MinIO.
 type JobArtifacts struct {
 	Video      string `json:"video,omitempty"`
@@ -41,115 +103,353 @@ type JobArtifacts struct {
 	Audio      string `json:"audio,omitempty"`
 	Preview    string `json:"preview,omitempty"`
 	HLS        string `json:"hls,omitempty"`
+	// ThumbnailCount is the number of thumb_NNN.jpg files under Thumbnails.
+	ThumbnailCount int `json:"thumbnail_count,omitempty"`
+	// Pipeline records which pipeline produced the artifacts; nil for artifacts
+	// produced before stamping (version 0).
+	Pipeline *PipelineStamp `json:"pipeline,omitempty"`
+	// SkippedSteps lists the optional steps disabled for the job; their artifacts are absent on purpose.
+	SkippedSteps []string `json:"skipped_steps,omitempty"`
+	// ResumedSteps lists the steps restored from the checkpoint of an earlier attempt instead of run.
+	ResumedSteps []string `json:"resumed_steps,omitempty"`
+	// TimedOutSteps lists the non-critical steps cancelled by the pipeline budget; their artifacts are absent.
+	TimedOutSteps []string `json:"timed_out_steps,omitempty"`
+}
+
+// PipelineStamp identifies the code (Version) and settings (SettingsHash) an
+// artifact set was produced with. See processor.PipelineVersion and processor.SettingsHash.
+type PipelineStamp struct {
+	Version      int    `json:"version"`
+	SettingsHash string `json:"settings_hash"`
+}
+
+// PipelineVersion returns the pipeline version of the job artifacts; 0 if the
+// job has none or they predate stamping.
+func (s *JobState) PipelineVersion() int {
+	if s.Artifacts == nil || s.Artifacts.Pipeline == nil {
+		return 0
+	}
+	return s.Artifacts.Pipeline.Version
 }
 
 // JobState represents the complete state of a processing job.
 type JobState struct {
+	VideoID     string         `json:"video_id,omitempty"`
 	Status      JobStatus      `json:"status"`
 	Error       string         `json:"error,omitempty"`
 	Artifacts   *JobArtifacts  `json:"artifacts,omitempty"`
 	Metadata    *VideoMetadata `json:"metadata,omitempty"`
 	RetryCount  int            `json:"retry_count"`
+	Priority    Priority       `json:"priority,omitempty"`
 	CallbackURL string         `json:"callback_url,omitempty"`
+	Spec        *JobSpec       `json:"spec,omitempty"`
 	CreatedAt   int64          `json:"created_at"`
 	UpdatedAt   int64          `json:"updated_at"`
+	// NextAttemptAt is when a delayed retry becomes due (unix seconds); 0 if none is scheduled.
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+	// Progress is the live pipeline progress of the current attempt.
+	Progress *JobProgress `json:"progress,omitempty"`
+	// Owner is the worker holding the lease of the current (or last) attempt.
+	Owner *JobOwner `json:"owner,omitempty"`
+	// ErrorCode classifies Error (see internal/joberrors).
+	ErrorCode joberrors.Code `json:"error_code,omitempty"`
+}
+
+// JobProgress is the overall completion of a running job and the step that last reported.
+type JobProgress struct {
+	Percent   float64 `json:"percent"`
+	Step      string  `json:"step,omitempty"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+// Attempt returns the 1-based attempt the job is on: every retry (explicit or
+// after lease expiry) increments RetryCount.
+func (s *JobState) Attempt() int {
+	return s.RetryCount + 1
+}
+
+// Tenant returns the tenant of the job, or "" for jobs on the shared queues.
+func (s *JobState) Tenant() string {
+	if s.Spec == nil {
+		return ""
+	}
+	return s.Spec.Tenant
 }
 
 func jobKey(videoID string) string {
-	return "job:" + videoID
+	return jobKeyPrefix + videoID
 }
 
+// setJobState writes the state and moves the job to the index of its status.
+// Every transition goes through here, so the status indexes follow the states.
 func setJobState(videoID string, state JobState) error {
 	state.UpdatedAt = time.Now().Unix()
 	data, err := json.Marshal(state)
 	if err != nil {
 		return fmt.Errorf("failed to serialize job state: %w", err)
 	}
-	return client.Set(context.Background(), jobKey(videoID), string(data), jobTTL).Err()
+	ctx := context.Background()
+	if err := client.Set(ctx, jobKey(videoID), string(data), jobTTL).Err(); err != nil {
+		return err
+	}
+	return indexJobState(ctx, videoID, state)
 }
 
-// PublishJob publishes a videoID to the queue and records the initial state as pending.
-// callbackURL is optional: if non-empty, the worker will notify this URL upon completion.
+// PublishJob validates spec, records the initial state as pending and publishes
+// the spec to the queue for its priority. spec.CallbackURL is optional: if non-empty,
+// the worker will notify this URL upon completion. An empty priority means
+// PriorityNormal (use PriorityForSize to derive one from the raw size).
+// Returns ErrJobActive if the video already has a pending or processing job.
 // Should be called by the producer (API) when submitting a video for processing.
-func PublishJob(videoID, callbackURL string) error {
+func PublishJob(spec JobSpec) error {
+	if spec.Version == 0 {
+		spec.Version = JobSpecVersion
+	}
+	if spec.Priority == "" {
+		spec.Priority = PriorityNormal
+	}
+	if err := spec.Validate(); err != nil {
+		return fmt.Errorf("invalid job spec: %w", err)
+	}
+	payload, err := encodeJobSpec(&spec)
+	if err != nil {
+		return err
+	}
+
 	state := JobState{
+		VideoID:     spec.VideoID,
 		Status:      JobStatusPending,
-		CallbackURL: callbackURL,
+		Priority:    spec.Priority,
+		CallbackURL: spec.CallbackURL,
+		Spec:        &spec,
 		CreatedAt:   time.Now().Unix(),
 	}
-	if err := setJobState(videoID, state); err != nil {
-		return fmt.Errorf("failed to create job state: %w", err)
+	unclaim, err := claimJob(spec.VideoID, state)
+	if err != nil {
+		return err
+	}
+	// A resubmitted video must not inherit the cancellation of a previous run.
+	if err := client.Del(context.Background(), cancelKey(spec.VideoID)).Err(); err != nil {
+		unclaim()
+		return fmt.Errorf("failed to clear cancel marker: %w", err)
+	}
+	if err := publishToQueue(context.Background(), spec.Priority, spec.Tenant, payload); err != nil {
+		// Without a message the pending state would block resubmissions until it expires.
+		unclaim()
+		return err
 	}
-	return client.LPush(context.Background(), cfg.ProcessingRequestQueue, videoID).Err()
+	appendJobEvent(spec.VideoID, JobEvent{Type: EventSubmitted, Status: JobStatusPending})
+	return nil
 }
 
-// SetJobProcessing updates the job state to processing.
-func SetJobProcessing(videoID string) error {
-	existing, _ := GetJobState(videoID)
+// claimJob writes the pending state of a new job with claimJobScript, then indexes
+// it. The returned unclaim restores the state it replaced (or deletes it), for a
+// job that could not be published after all.
+func claimJob(videoID string, state JobState) (unclaim func(), err error) {
+	state.UpdatedAt = time.Now().Unix()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize job state: %w", err)
+	}
+	ctx := context.Background()
+	reply, err := claimJobScript.Run(ctx, client, []string{jobKey(videoID)}, string(data), jobTTL.Milliseconds()).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job state: %w", err)
+	}
+	if blocking, _ := reply[0].(string); blocking != "" {
+		return nil, fmt.Errorf("%w: %s", ErrJobActive, blocking)
+	}
+	var previous string
+	if len(reply) > 1 {
+		previous, _ = reply[1].(string)
+	}
+	unclaim = func() { unclaimJob(ctx, videoID, string(data), previous) }
+	if err := indexJobState(ctx, videoID, state); err != nil {
+		unclaim()
+		return nil, err
+	}
+	return unclaim, nil
+}
+
+// unclaimJob rolls back a claim with unclaimJobScript and moves the job back to
+// the index of the restored state. Failures are only logged: the caller is
+// already returning the error that made it give up the claim.
+func unclaimJob(ctx context.Context, videoID, claimed, previous string) {
+	restored, err := unclaimJobScript.Run(ctx, client, []string{jobKey(videoID)}, claimed, previous, jobTTL.Milliseconds()).Int()
+	if err != nil {
+		log.Error().Err(err).Str("videoID", videoID).Msg("Failed to roll back job claim")
+		return
+	}
+	if restored == 0 {
+		return
+	}
+	if previous == "" {
+		if err := client.ZRem(ctx, statusIndexKey(JobStatusPending), videoID).Err(); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to drop rolled back job from status index")
+		}
+		return
+	}
+	if state, err := decodeJobState(videoID, []byte(previous)); err == nil {
+		if err := indexJobState(ctx, videoID, *state); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to restore job status index")
+		}
+	}
+}
+
+// SetJobProcessing updates the job state to processing, records the worker
+// that owns it and returns the updated state (its attempt number is RetryCount+1).
+// The owner must hold the job lease (AcquireLease) before calling it.
+func SetJobProcessing(videoID string, owner JobOwner) (*JobState, error) {
+	existing, _ := getLiveJobState(videoID)
 	if existing == nil {
 		existing = &JobState{CreatedAt: time.Now().Unix()}
 	}
 	existing.Status = JobStatusProcessing
-	return setJobState(videoID, *existing)
+	existing.Owner = &owner
+	existing.NextAttemptAt = 0
+	existing.Progress = &JobProgress{UpdatedAt: time.Now().Unix()}
+	if err := setJobState(videoID, *existing); err != nil {
+		return nil, err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventStarted, Status: JobStatusProcessing, Attempt: existing.Attempt(), Owner: &owner})
+	return existing, nil
 }
 
 // SetJobDone updates the job state to done with the generated artifacts and metadata.
 func SetJobDone(videoID string, artifacts JobArtifacts, metadata *VideoMetadata) error {
-	existing, _ := GetJobState(videoID)
+	existing, _ := getLiveJobState(videoID)
 	if existing == nil {
 		existing = &JobState{CreatedAt: time.Now().Unix()}
 	}
 	existing.Status = JobStatusDone
+	existing.Progress = &JobProgress{Percent: 100, UpdatedAt: time.Now().Unix()}
 	existing.Artifacts = &artifacts
 	existing.Metadata = metadata
 	existing.Error = ""
-	return setJobState(videoID, *existing)
+	existing.ErrorCode = ""
+	if err := setJobState(videoID, *existing); err != nil {
+		return err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventSucceeded, Status: JobStatusDone, Attempt: existing.Attempt(), Owner: existing.Owner})
+	archiveJob(videoID, *existing)
+	return nil
 }
 
-// SetJobFailed updates the job state to failed, increments the retry counter,
+// SetJobFailed updates the job state to failed, records the error code of jobErr,
 // and returns the updated state so the caller can decide between retry and DLQ.
+// A transient failure increments the retry counter; a permanent one is terminal,
+// keeps the counter and is archived.
 func SetJobFailed(videoID string, jobErr error) (*JobState, error) {
-	existing, _ := GetJobState(videoID)
+	existing, _ := getLiveJobState(videoID)
 	if existing == nil {
 		existing = &JobState{CreatedAt: time.Now().Unix()}
 	}
+	attempt := existing.Attempt()
 	existing.Status = JobStatusFailed
 	existing.Error = jobErr.Error()
-	existing.RetryCount++
+	existing.ErrorCode = joberrors.CodeOf(jobErr)
+	permanent := joberrors.IsPermanent(jobErr)
+	if !permanent {
+		existing.RetryCount++
+	}
 	if err := setJobState(videoID, *existing); err != nil {
 		return nil, err
 	}
+	appendJobEvent(videoID, JobEvent{
+		Type:      EventFailed,
+		Status:    JobStatusFailed,
+		Attempt:   attempt,
+		Owner:     existing.Owner,
+		Error:     existing.Error,
+		ErrorCode: existing.ErrorCode,
+	})
+	if permanent {
+		archiveJob(videoID, *existing)
+	}
 	return existing, nil
 }
 
-// RequeueJob puts the job back in the main queue for reprocessing.
-// AcknowledgeMessage must still be called to remove it from the processing queue.
+// RequeueJob puts the job back in the queue matching its priority and tenant for immediate reprocessing,
+// republishing the persisted spec (or the bare videoID for legacy jobs).
+// AcknowledgeMessage must still be called to remove it from the in-flight set.
 func RequeueJob(videoID string) error {
-	existing, _ := GetJobState(videoID)
+	var priority Priority
+	var tenant string
+	payload := videoID
+	existing, _ := getLiveJobState(videoID)
 	if existing != nil {
 		existing.Status = JobStatusPending
+		priority = existing.Priority
+		tenant = existing.Tenant()
+		if existing.Spec != nil {
+			encoded, err := encodeJobSpec(existing.Spec)
+			if err != nil {
+				return err
+			}
+			payload = encoded
+		}
 		if err := setJobState(videoID, *existing); err != nil {
 			return fmt.Errorf("failed to update state for requeue: %w", err)
 		}
+		appendJobEvent(videoID, JobEvent{Type: EventRequeued, Status: JobStatusPending, Attempt: existing.Attempt()})
 	}
-	return client.LPush(context.Background(), cfg.ProcessingRequestQueue, videoID).Err()
+	return publishToQueue(context.Background(), priority, tenant, payload)
 }
 
-// MoveToDLQ moves the job to the dead letter queue after exhausting retries.
-// AcknowledgeMessage must still be called to remove it from the processing queue.
-func MoveToDLQ(videoID string) error {
-	return client.LPush(context.Background(), deadLetterQueueName(), videoID).Err()
+// MoveToDLQ moves the job to the dead letter queue after exhausting retries and
+// archives its final (failed) state. The entry is the encoded spec, so a redrive
+// restores the original job even after its state expired.
+// AcknowledgeMessage must still be called to remove it from the in-flight set.
+func MoveToDLQ(spec *JobSpec) error {
+	videoID := spec.VideoID
+	payload, err := encodeJobSpec(spec)
+	if err != nil {
+		return err
+	}
+	if err := client.LPush(context.Background(), deadLetterQueueName(), payload).Err(); err != nil {
+		return err
+	}
+	appendJobEvent(videoID, JobEvent{Type: EventDeadLettered, Status: JobStatusFailed})
+	if state, err := getLiveJobState(videoID); err == nil {
+		archiveJob(videoID, *state)
+	}
+	return nil
 }
 
-// GetJobState returns the current state of a job. Returns nil if the job does not exist.
+// GetJobState returns the current state of a job. Once the Redis key has
+// expired, the archived terminal state is returned instead (see SetJobArchive).
+// Returns ErrJobNotFound if the job does not exist in either.
+// It is meant for reads; state transitions use getLiveJobState.
 func GetJobState(videoID string) (*JobState, error) {
+	state, err := getLiveJobState(videoID)
+	if errors.Is(err, ErrJobNotFound) {
+		return getArchivedJobState(videoID)
+	}
+	return state, err
+}
+
+// getLiveJobState returns the job state from Redis only, or ErrJobNotFound.
+// Transitions must not start from the archive: it holds a finished run, whose
+// retry count, artifacts and error would leak into the new one.
+func getLiveJobState(videoID string) (*JobState, error) {
 	data, err := client.Get(context.Background(), jobKey(videoID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("job not found: %w", err)
+		return nil, fmt.Errorf("failed to read job state: %w", err)
 	}
+	return decodeJobState(videoID, data)
+}
+
+func decodeJobState(videoID string, data []byte) (*JobState, error) {
 	var state JobState
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil, fmt.Errorf("failed to deserialize job state: %w", err)
 	}
+	// States written before VideoID was persisted only carry it in the key.
+	if state.VideoID == "" {
+		state.VideoID = videoID
+	}
 	return &state, nil
 }
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	leaseKeyPrefix = "lease:"
+
+	// defaultJobLeaseTTL applies when the config leaves JobLeaseTTL unset.
+	defaultJobLeaseTTL = 30 * time.Second
+)
+
+// ErrLeaseLost is the cancellation cause of a job whose lease expired or was
+// taken over: another worker may be running it, so it must be dropped.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// renewLeaseScript extends the lease only while it is still held by the caller,
+// so a worker that lost its lease cannot take it back from the new owner.
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript deletes the lease only while it is still held by the caller.
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// JobOwner identifies the worker holding the lease of a processing job.
+type JobOwner struct {
+	InstanceID string `json:"instance_id"`
+	WorkerID   int    `json:"worker_id"`
+}
+
+func (o JobOwner) String() string {
+	return fmt.Sprintf("%s/%d", o.InstanceID, o.WorkerID)
+}
+
+// NewJobOwner returns the owner identity of workerID on this instance.
+func NewJobOwner(workerID int) JobOwner {
+	return JobOwner{InstanceID: instanceID, WorkerID: workerID}
+}
+
+func jobLeaseTTL() time.Duration {
+	if cfg.JobLeaseTTL <= 0 {
+		return defaultJobLeaseTTL
+	}
+	return cfg.JobLeaseTTL
+}
+
+func leaseKey(videoID string) string {
+	return leaseKeyPrefix + videoID
+}
+
+// Lease is a renewable claim on a job. While it is held, orphan recovery leaves
+// the job alone; once the holder stops renewing (crash, network partition) the
+// key expires after JOB_LEASE_TTL and recovery requeues the job.
+type Lease struct {
+	videoID string
+	owner   JobOwner
+	ttl     time.Duration
+	stop    chan struct{}
+	done    chan struct{}
+	// lost is closed when the lease is found taken over, or could not be renewed for a whole TTL.
+	lost chan struct{}
+	once sync.Once
+}
+
+// AcquireLease takes the lease of videoID for owner and starts heartbeating it
+// every JOB_LEASE_TTL/3 until Release is called. The consumer already owns the
+// message, so an existing (expired-but-not-yet-deleted) lease is overwritten.
+func AcquireLease(videoID string, owner JobOwner) (*Lease, error) {
+	ttl := jobLeaseTTL()
+	if err := client.Set(context.Background(), leaseKey(videoID), owner.String(), ttl).Err(); err != nil {
+		return nil, fmt.Errorf("failed to acquire job lease: %w", err)
+	}
+	l := &Lease{
+		videoID: videoID,
+		owner:   owner,
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	go l.heartbeat()
+	return l, nil
+}
+
+func (l *Lease) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			renewed, err := renewLeaseScript.Run(context.Background(), client,
+				[]string{leaseKey(l.videoID)}, l.owner.String(), l.ttl.Milliseconds()).Int()
+			if err != nil {
+				log.Warn().Err(err).Str("videoID", l.videoID).Msg("Failed to renew job lease")
+				if time.Since(renewedAt) < l.ttl {
+					continue
+				}
+				// Unrenewed for a whole TTL: the key has expired on the server.
+			} else if renewed != 0 {
+				renewedAt = time.Now()
+				continue
+			}
+			// Expired and possibly reclaimed: another worker may be running the job now.
+			log.Error().Str("videoID", l.videoID).Str("owner", l.owner.String()).Msg("Job lease lost")
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// Context returns a context derived from parent that is cancelled with
+// ErrLeaseLost when the lease is lost. cancel must be called when the job ends.
+func (l *Lease) Context(parent context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-l.lost:
+			cancelCause(ErrLeaseLost)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancelCause(nil) }
+}
+
+// Release stops the heartbeat and deletes the lease if it is still ours.
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		if err := releaseLeaseScript.Run(context.Background(), client,
+			[]string{leaseKey(l.videoID)}, l.owner.String()).Err(); err != nil {
+			log.Warn().Err(err).Str("videoID", l.videoID).Msg("Failed to release job lease")
+		}
+	})
+}
+
+// leaseHeld reports whether some worker currently holds the lease of videoID.
+func leaseHeld(ctx context.Context, videoID string) (bool, error) {
+	n, err := client.Exists(ctx, leaseKey(videoID)).Result()
+	return n > 0, err
+}
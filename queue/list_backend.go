@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// listBackend delivers jobs through Redis lists. BRPOPLPUSH atomically moves
+// each job into the shared <queue>:processing list, which acts as the in-flight set.
+type listBackend struct{}
+
+func (b *listBackend) Publish(ctx context.Context, queue, payload string) error {
+	return client.LPush(ctx, queue, payload).Err()
+}
+
+// Consume uses RPOPLPUSH when not blocking and BRPOPLPUSH otherwise
+// (Redis rounds positive timeouts up to whole seconds).
+func (b *listBackend) Consume(ctx context.Context, queue string, timeout time.Duration) (*Message, error) {
+	var payload string
+	var err error
+	if timeout < 0 {
+		payload, err = client.RPopLPush(ctx, queue, processingQueueName()).Result()
+	} else {
+		payload, err = client.BRPopLPush(ctx, queue, processingQueueName(), timeout).Result()
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Payload: payload, Queue: queue}, nil
+}
+
+func (b *listBackend) Ack(ctx context.Context, msg *Message) error {
+	return client.LRem(ctx, processingQueueName(), 1, msg.Payload).Err()
+}
+
+func (b *listBackend) Len(ctx context.Context, queue string) (int64, error) {
+	return client.LLen(ctx, queue).Result()
+}
+
+// InFlight lists the processing queue. Lists carry no delivery metadata,
+// so the source queue, idle time and delivery count are unknown.
+func (b *listBackend) InFlight(ctx context.Context, _ time.Duration) ([]*Message, error) {
+	payloads, err := client.LRange(ctx, processingQueueName(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, 0, len(payloads))
+	for _, payload := range payloads {
+		msgs = append(msgs, &Message{Payload: payload})
+	}
+	return msgs, nil
+}
+
+// Reclaim removes the job from the processing queue. LREM is atomic, so only
+// one recovering instance gets a non-zero count for the same entry.
+func (b *listBackend) Reclaim(ctx context.Context, msg *Message) (bool, error) {
+	removed, err := client.LRem(ctx, processingQueueName(), 1, msg.Payload).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// Remove drops every copy of payload from the waiting list.
+func (b *listBackend) Remove(ctx context.Context, queue, payload string) (int64, error) {
+	return client.LRem(ctx, queue, 0, payload).Result()
+}
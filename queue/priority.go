@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Priority routes a job to one of the request queues.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Priority consumption modes selectable via QUEUE_PRIORITY_MODE.
+const (
+	PriorityModeStrict   = "strict"
+	PriorityModeWeighted = "weighted"
+)
+
+// priorities lists the priorities from highest to lowest.
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// defaultPriorityWeights is used when QUEUE_PRIORITY_WEIGHTS is empty.
+var defaultPriorityWeights = map[Priority]int{PriorityHigh: 6, PriorityNormal: 3, PriorityLow: 1}
+
+// priorityWeights holds the parsed weights for weighted mode.
+var priorityWeights = defaultPriorityWeights
+
+// ValidPriority reports whether p is a known priority. Empty is not valid.
+func ValidPriority(p Priority) bool {
+	for _, known := range priorities {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// queueForPriority returns the request queue for p. Normal (and unknown) priority
+// maps to ProcessingRequestQueue itself so producers that LPUSH directly keep working.
+func queueForPriority(p Priority) string {
+	switch p {
+	case PriorityHigh, PriorityLow:
+		return queueKey(cfg.ProcessingRequestQueue, string(p))
+	default:
+		return cfg.ProcessingRequestQueue
+	}
+}
+
+// PriorityForSize derives a priority from the raw object size using
+// PRIORITY_HIGH_MAX_SIZE_MB and PRIORITY_LOW_MIN_SIZE_MB, so short clips skip ahead of long uploads.
+func PriorityForSize(sizeBytes int64) Priority {
+	const mb = 1024 * 1024
+	switch {
+	case cfg.PriorityHighMaxSizeMB > 0 && sizeBytes <= cfg.PriorityHighMaxSizeMB*mb:
+		return PriorityHigh
+	case cfg.PriorityLowMinSizeMB > 0 && sizeBytes >= cfg.PriorityLowMinSizeMB*mb:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// parsePriorityWeights parses "high:6,normal:3,low:1". Missing priorities get weight 0
+// (only consumed when every weighted queue is empty).
+func parsePriorityWeights(s string) (map[Priority]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultPriorityWeights, nil
+	}
+	weights := make(map[Priority]int, len(priorities))
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid priority weight %q (expected name:weight)", part)
+		}
+		p := Priority(strings.TrimSpace(name))
+		if !ValidPriority(p) {
+			return nil, fmt.Errorf("unknown priority %q", name)
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %q", p, value)
+		}
+		weights[p] = w
+	}
+	return weights, nil
+}
+
+// priorityOrder returns the order in which the priority queues are polled for the next job.
+// Strict mode always returns high → normal → low. Weighted mode draws priorities
+// without replacement proportionally to their weights, so lower priorities still
+// get a share of the workers while higher ones are busy.
+func priorityOrder(mode string, weights map[Priority]int, rng func(int) int) []Priority {
+	if mode != PriorityModeWeighted {
+		return priorities
+	}
+
+	remaining := make([]Priority, len(priorities))
+	copy(remaining, priorities)
+	order := make([]Priority, 0, len(priorities))
+	for len(remaining) > 0 {
+		total := 0
+		for _, p := range remaining {
+			total += weights[p]
+		}
+		if total == 0 {
+			// Zero-weight priorities keep strict order at the end.
+			order = append(order, remaining...)
+			break
+		}
+		pick := rng(total)
+		for i, p := range remaining {
+			pick -= weights[p]
+			if pick < 0 {
+				order = append(order, p)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	return order
+}
+
+func nextPriorityOrder() []Priority {
+	return priorityOrder(cfg.QueuePriorityMode, priorityWeights, rand.IntN)
+}
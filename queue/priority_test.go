@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+
+	"video-processor/config"
+)
+
+func TestParsePriorityWeights(t *testing.T) {
+	weights, err := parsePriorityWeights("high:5, normal:2,low:0")
+	if err != nil {
+		t.Fatalf("parsePriorityWeights() failed: %v", err)
+	}
+	expected := map[Priority]int{PriorityHigh: 5, PriorityNormal: 2, PriorityLow: 0}
+	if !reflect.DeepEqual(weights, expected) {
+		t.Errorf("expected %v, got %v", expected, weights)
+	}
+
+	if weights, err := parsePriorityWeights(""); err != nil || !reflect.DeepEqual(weights, defaultPriorityWeights) {
+		t.Errorf("empty string should return defaults, got %v (err: %v)", weights, err)
+	}
+
+	for _, invalid := range []string{"high", "urgent:1", "high:-1", "high:x"} {
+		if _, err := parsePriorityWeights(invalid); err == nil {
+			t.Errorf("parsePriorityWeights(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestPriorityOrder_Strict(t *testing.T) {
+	order := priorityOrder(PriorityModeStrict, defaultPriorityWeights, func(int) int { return 0 })
+	expected := []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestPriorityOrder_Weighted(t *testing.T) {
+	weights := map[Priority]int{PriorityHigh: 6, PriorityNormal: 3, PriorityLow: 1}
+
+	// First draw lands in low's share (9 of total 10), second in high's, third picks the last one.
+	draws := []int{9, 0, 0}
+	rng := func(n int) int {
+		v := draws[0]
+		draws = draws[1:]
+		return v
+	}
+	order := priorityOrder(PriorityModeWeighted, weights, rng)
+	expected := []Priority{PriorityLow, PriorityHigh, PriorityNormal}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestPriorityOrder_WeightedZeroWeightsLast(t *testing.T) {
+	weights := map[Priority]int{PriorityLow: 1}
+	order := priorityOrder(PriorityModeWeighted, weights, func(int) int { return 0 })
+	expected := []Priority{PriorityLow, PriorityHigh, PriorityNormal}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestPriorityForSize(t *testing.T) {
+	cfg = &config.Config{PriorityHighMaxSizeMB: 100, PriorityLowMinSizeMB: 1024}
+	const mb = 1024 * 1024
+
+	cases := []struct {
+		size     int64
+		expected Priority
+	}{
+		{10 * mb, PriorityHigh},
+		{100 * mb, PriorityHigh},
+		{500 * mb, PriorityNormal},
+		{2048 * mb, PriorityLow},
+	}
+	for _, c := range cases {
+		if got := PriorityForSize(c.size); got != c.expected {
+			t.Errorf("PriorityForSize(%d) = %s, expected %s", c.size, got, c.expected)
+		}
+	}
+}
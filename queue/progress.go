@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// setJobProgressScript replaces the job state with ARGV[2] (TTL ARGV[3] ms) only
+// if it is still ARGV[1], the state the progress was computed from. Returns 1 if it did.
+var setJobProgressScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// progressWriteAttempts bounds the retries of a progress write that raced another write.
+const progressWriteAttempts = 3
+
+// SetJobProgress records the live progress of a processing job. It is a no-op
+// once the job left the processing status, so a late update cannot overwrite
+// a final state: the write is a compare-and-set against the state it read.
+func SetJobProgress(videoID string, percent float64, step string) error {
+	ctx := context.Background()
+	for attempt := 0; attempt < progressWriteAttempts; attempt++ {
+		current, err := client.Get(ctx, jobKey(videoID)).Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read job state: %w", err)
+		}
+		state, err := decodeJobState(videoID, []byte(current))
+		if err != nil {
+			return err
+		}
+		if state.Status != JobStatusProcessing {
+			return nil
+		}
+		state.Progress = &JobProgress{
+			Percent:   math.Round(percent*10) / 10,
+			Step:      step,
+			UpdatedAt: time.Now().Unix(),
+		}
+		state.UpdatedAt = time.Now().Unix()
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to serialize job state: %w", err)
+		}
+		written, err := setJobProgressScript.Run(ctx, client, []string{jobKey(videoID)}, current, string(data), jobTTL.Milliseconds()).Int()
+		if err != nil {
+			return fmt.Errorf("failed to write job progress: %w", err)
+		}
+		if written == 1 {
+			return indexJobState(ctx, videoID, *state)
+		}
+	}
+	return fmt.Errorf("failed to write job progress: state kept changing")
+}
+
+// NewProgressRecorder returns a progress callback for videoID that persists at
+// most one update per minInterval, and only when the percentage changed, to keep
+// Redis writes bounded while FFmpeg reports several times per second from
+// several steps at once.
+func NewProgressRecorder(videoID string, minInterval time.Duration) func(percent float64, step string) {
+	t := progressThrottle{minInterval: minInterval, now: time.Now}
+	return func(percent float64, step string) {
+		if !t.allow(math.Round(percent*10) / 10) {
+			return
+		}
+		if err := SetJobProgress(videoID, percent, step); err != nil {
+			log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update job progress")
+		}
+	}
+}
+
+// progressThrottle decides which progress updates of one job are persisted.
+type progressThrottle struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	now         func() time.Time
+	last        time.Time
+	lastPercent float64
+	started     bool
+}
+
+func (t *progressThrottle) allow(percent float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if t.started && (percent == t.lastPercent || now.Sub(t.last) < t.minInterval) {
+		return false
+	}
+	t.started = true
+	t.last = now
+	t.lastPercent = percent
+	return true
+}
@@ -0,0 +1,29 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressThrottle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	throttle := progressThrottle{minInterval: 2 * time.Second, now: func() time.Time { return now }}
+
+	if !throttle.allow(10) {
+		t.Fatal("expected first update to be persisted")
+	}
+	now = now.Add(time.Second)
+	if throttle.allow(12) {
+		t.Error("expected update within the interval to be dropped")
+	}
+	now = now.Add(2 * time.Second)
+	if throttle.allow(10) {
+		t.Error("expected unchanged percentage to be dropped")
+	}
+	if !throttle.allow(15) {
+		t.Error("expected update after the interval to be persisted")
+	}
+	if throttle.allow(16) {
+		t.Error("expected interval to restart after a persisted update")
+	}
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"video-processor/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis topologies accepted by REDIS_MODE.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+// redisOptions maps the Redis settings of c to client options.
+// The mode is explicit rather than inferred from the number of addresses, so a
+// cluster reached through a single seed node is not mistaken for a standalone server.
+func redisOptions(c *config.Config) (*redis.UniversalOptions, error) {
+	var addrs []string
+	for _, addr := range strings.Split(c.RedisHost, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("REDIS_HOST is empty")
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:    addrs,
+		Username: c.RedisUsername,
+		Password: c.RedisPassword,
+	}
+
+	switch c.RedisMode {
+	case "", RedisModeStandalone:
+		if len(addrs) > 1 {
+			return nil, fmt.Errorf("standalone mode takes a single REDIS_HOST, got %d (set REDIS_MODE=cluster or sentinel)", len(addrs))
+		}
+	case RedisModeSentinel:
+		if c.RedisSentinelMaster == "" {
+			return nil, fmt.Errorf("sentinel mode requires REDIS_SENTINEL_MASTER")
+		}
+		opts.MasterName = c.RedisSentinelMaster
+		opts.SentinelPassword = c.RedisSentinelPassword
+	case RedisModeCluster:
+		opts.IsClusterMode = true
+	default:
+		return nil, fmt.Errorf("unknown REDIS_MODE %q (use standalone, sentinel or cluster)", c.RedisMode)
+	}
+
+	if c.RedisTLS {
+		tlsConfig, err := redisTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+// redisTLSConfig builds the TLS settings: REDIS_TLS_CA_FILE replaces the system
+// roots, and REDIS_TLS_CERT_FILE + REDIS_TLS_KEY_FILE present a client certificate.
+func redisTLSConfig(c *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.RedisTLSCAFile != "" {
+		pem, err := os.ReadFile(c.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", c.RedisTLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.RedisTLSCertFile == "") != (c.RedisTLSKeyFile == "") {
+		return nil, fmt.Errorf("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+	if c.RedisTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.RedisTLSCertFile, c.RedisTLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// queueKey returns the key derived from the queue name with suffix (e.g. <queue>:processing).
+//
+// In cluster mode the name is wrapped in a hash tag ({<queue>}:processing): Redis
+// then hashes only the name, so every derived key shares the slot of the bare
+// <queue> list that producers LPUSH to, and multi-key commands such as
+// BRPOPLPUSH into :processing stay legal. Names that already carry a tag keep it.
+func queueKey(name, suffix string) string {
+	if cfg != nil && cfg.RedisMode == RedisModeCluster && !strings.Contains(name, "{") {
+		name = "{" + name + "}"
+	}
+	return name + ":" + suffix
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"testing"
+
+	"video-processor/config"
+)
+
+func TestRedisOptions_Modes(t *testing.T) {
+	opts, err := redisOptions(&config.Config{RedisHost: "redis:6379", RedisPassword: "secret", RedisUsername: "worker"})
+	if err != nil {
+		t.Fatalf("standalone: unexpected error: %v", err)
+	}
+	if opts.IsClusterMode || opts.MasterName != "" || opts.Username != "worker" || opts.Password != "secret" {
+		t.Errorf("standalone: unexpected options %+v", opts)
+	}
+
+	opts, err = redisOptions(&config.Config{
+		RedisHost:           "s1:26379, s2:26379",
+		RedisMode:           RedisModeSentinel,
+		RedisSentinelMaster: "mymaster",
+	})
+	if err != nil {
+		t.Fatalf("sentinel: unexpected error: %v", err)
+	}
+	if opts.MasterName != "mymaster" || len(opts.Addrs) != 2 || opts.Addrs[1] != "s2:26379" {
+		t.Errorf("sentinel: unexpected options %+v", opts)
+	}
+
+	opts, err = redisOptions(&config.Config{RedisHost: "seed:7000", RedisMode: RedisModeCluster})
+	if err != nil {
+		t.Fatalf("cluster: unexpected error: %v", err)
+	}
+	if !opts.IsClusterMode {
+		t.Error("cluster: expected cluster mode even with a single seed node")
+	}
+}
+
+func TestRedisOptions_Invalid(t *testing.T) {
+	cases := map[string]*config.Config{
+		"unknown mode":             {RedisHost: "redis:6379", RedisMode: "ring"},
+		"standalone with two":      {RedisHost: "a:6379,b:6379"},
+		"sentinel without master":  {RedisHost: "s1:26379", RedisMode: RedisModeSentinel},
+		"cert without key":         {RedisHost: "redis:6379", RedisTLS: true, RedisTLSCertFile: "client.crt"},
+		"missing CA file":          {RedisHost: "redis:6379", RedisTLS: true, RedisTLSCAFile: "/does/not/exist.pem"},
+		"empty address after trim": {RedisHost: " , "},
+	}
+	for name, c := range cases {
+		if _, err := redisOptions(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestQueueKey_HashTagsOnlyInClusterMode(t *testing.T) {
+	prev := cfg
+	defer func() { cfg = prev }()
+
+	cfg = &config.Config{ProcessingRequestQueue: "video_queue"}
+	if got := processingQueueName(); got != "video_queue:processing" {
+		t.Errorf("standalone: expected video_queue:processing, got %s", got)
+	}
+
+	cfg = &config.Config{ProcessingRequestQueue: "video_queue", RedisMode: RedisModeCluster}
+	cases := []struct{ got, want string }{
+		{processingQueueName(), "{video_queue}:processing"},
+		{deadLetterQueueName(), "{video_queue}:dead"},
+		{delayedQueueName(), "{video_queue}:delayed"},
+		{queueForPriority(PriorityHigh), "{video_queue}:high"},
+		{queueForPriority(PriorityNormal), "video_queue"},
+		{streamKey("video_queue"), "{video_queue}:stream"},
+		{streamKey("{video_queue}:low"), "{video_queue}:low:stream"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("cluster: expected %s, got %s", c.want, c.got)
+		}
+	}
+}
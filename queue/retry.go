@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"video-processor/internal/circuitbreaker"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// delayedPollInterval is how often the mover checks for due retries.
+	delayedPollInterval = time.Second
+	// delayedBatchSize caps the number of retries promoted per poll.
+	delayedBatchSize = 100
+)
+
+// delayedQueueName returns the sorted set holding retries scored by next-attempt time (unix ms).
+func delayedQueueName() string {
+	return queueKey(cfg.ProcessingRequestQueue, "delayed")
+}
+
+// retryBackoff returns the delay before retry number attempt (1-based):
+// base * 2^(attempt-1), capped at max, then spread by ±jitter (fraction of the delay).
+// rng returns a value in [0, 1). A non-positive base disables the delay.
+func retryBackoff(attempt int, base, max time.Duration, jitter float64, rng func() float64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(base) * math.Pow(2, float64(attempt-1))
+	if max > 0 && delay > float64(max) {
+		delay = float64(max)
+	}
+	if jitter > 0 {
+		delay *= 1 + jitter*(2*rng()-1)
+	}
+	if max > 0 && delay > float64(max) {
+		delay = float64(max)
+	}
+	return time.Duration(delay)
+}
+
+// ScheduleRetry parks the job in the delayed set until its backoff elapses
+// (see RETRY_BACKOFF_*) and records NextAttemptAt in its state. With backoff
+// disabled the job is requeued immediately. Returns the time of the next attempt.
+// The ZADD comes first: once it succeeded the retry happens even if the state
+// write fails, and on an error nothing is scheduled, so the caller must leave the
+// message in flight for orphan recovery instead of acknowledging it.
+// On success AcknowledgeMessage must still be called to remove it from the in-flight set.
+func ScheduleRetry(videoID string) (time.Time, error) {
+	existing, err := getLiveJobState(videoID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read state for retry: %w", err)
+	}
+	delay := retryBackoff(existing.RetryCount, cfg.RetryBackoffBase, cfg.RetryBackoffMax, cfg.RetryBackoffJitter, rand.Float64)
+	if delay <= 0 {
+		return time.Now(), RequeueJob(videoID)
+	}
+
+	payload := videoID
+	if existing.Spec != nil {
+		if payload, err = encodeJobSpec(existing.Spec); err != nil {
+			return time.Time{}, err
+		}
+	}
+	next := time.Now().Add(delay)
+	_, err = circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return nil, client.ZAdd(context.Background(), delayedQueueName(), redis.Z{
+			Score:  float64(next.UnixMilli()),
+			Member: payload,
+		}).Err()
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule retry: %w", err)
+	}
+
+	existing.Status = JobStatusPending
+	existing.NextAttemptAt = next.Unix()
+	if err := setJobState(videoID, *existing); err != nil {
+		// The retry is scheduled; the next attempt rewrites the state.
+		log.Warn().Err(err).Str("videoID", videoID).Msg("Failed to update state for retry")
+	}
+	appendJobEvent(videoID, JobEvent{
+		Type:          EventRetryScheduled,
+		Status:        JobStatusPending,
+		Attempt:       existing.Attempt(),
+		NextAttemptAt: existing.NextAttemptAt,
+	})
+	return next, nil
+}
+
+// StartDelayedRetries periodically promotes due retries from the delayed set to
+// the request queue of their priority. Safe to run on every instance: ZREM decides
+// which instance promotes a given entry.
+func StartDelayedRetries(ctx context.Context) {
+	ticker := time.NewTicker(delayedPollInterval)
+	defer ticker.Stop()
+	log.Info().
+		Dur("backoff_base", cfg.RetryBackoffBase).
+		Dur("backoff_max", cfg.RetryBackoffMax).
+		Msg("Delayed retry mover started")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+				return nil, promoteDueRetries(ctx, time.Now())
+			}); err != nil {
+				log.Warn().Err(err).Msg("Failed to promote delayed retries")
+			}
+		}
+	}
+}
+
+func promoteDueRetries(ctx context.Context, now time.Time) error {
+	due, err := client.ZRangeByScore(ctx, delayedQueueName(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: delayedBatchSize,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read delayed retries: %w", err)
+	}
+
+	for _, payload := range due {
+		removed, err := client.ZRem(ctx, delayedQueueName(), payload).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim delayed retry: %w", err)
+		}
+		if removed == 0 {
+			continue // promoted by another instance
+		}
+
+		priority := PriorityNormal
+		var videoID, tenant string
+		if spec, err := ParseJobSpec(payload); err == nil {
+			videoID = spec.VideoID
+			tenant = spec.Tenant
+			if state, err := getLiveJobState(videoID); err == nil && state.Priority != "" {
+				priority = state.Priority
+			} else if spec.Priority != "" {
+				priority = spec.Priority
+			}
+		}
+		if err := publishToQueue(ctx, priority, tenant, payload); err != nil {
+			// Put it back as due so the next poll retries the promotion.
+			client.ZAdd(ctx, delayedQueueName(), redis.Z{Score: float64(now.UnixMilli()), Member: payload})
+			return fmt.Errorf("failed to promote delayed retry: %w", err)
+		}
+		log.Info().Str("videoID", videoID).Str("priority", string(priority)).Msg("Delayed retry promoted")
+	}
+	return nil
+}
+
+// GetDelayedQueueSize returns the number of retries waiting for their backoff to elapse.
+func GetDelayedQueueSize() (int64, error) {
+	result, err := circuitbreaker.Redis.Execute(func() (interface{}, error) {
+		return client.ZCard(context.Background(), delayedQueueName()).Result()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
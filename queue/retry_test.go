@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff_Exponential(t *testing.T) {
+	noJitter := func() float64 { return 0.5 }
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{10, 5 * time.Minute},
+	}
+
+	for _, c := range cases {
+		got := retryBackoff(c.attempt, 10*time.Second, 5*time.Minute, 0, noJitter)
+		if got != c.want {
+			t.Errorf("attempt %d: expected %v, got %v", c.attempt, c.want, got)
+		}
+	}
+}
+
+func TestRetryBackoff_Jitter(t *testing.T) {
+	base := 10 * time.Second
+
+	if got := retryBackoff(1, base, time.Minute, 0.2, func() float64 { return 0 }); got != 8*time.Second {
+		t.Errorf("expected lower bound 8s, got %v", got)
+	}
+	if got := retryBackoff(1, base, time.Minute, 0.2, func() float64 { return 0.5 }); got != base {
+		t.Errorf("expected midpoint %v, got %v", base, got)
+	}
+	if got := retryBackoff(3, base, 40*time.Second, 0.2, func() float64 { return 0.99 }); got != 40*time.Second {
+		t.Errorf("expected jitter to stay within max 40s, got %v", got)
+	}
+}
+
+func TestRetryBackoff_Disabled(t *testing.T) {
+	if got := retryBackoff(2, 0, time.Minute, 0.2, func() float64 { return 0.9 }); got != 0 {
+		t.Errorf("expected no delay with zero base, got %v", got)
+	}
+}
@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JobSpecVersion is the latest job spec version understood by this worker.
+const JobSpecVersion = 1
+
+// Upper bounds of ThumbnailSpec, so a spec cannot make FFmpeg extract an
+// unbounded number of frames or scale them to huge images.
+const (
+	MaxThumbnailCount     = 100
+	MaxThumbnailDimension = 3840
+)
+
+// JobSpec describes what a job should do. It is published as the queue message
+// (JSON) and persisted in JobState. Messages that are a bare videoID (published
+// before specs existed, or LPUSHed directly by a producer) are parsed as a
+// version 0 spec that runs the default pipeline.
+type JobSpec struct {
+	Version int    `json:"version"`
+	VideoID string `json:"video_id"`
+	// Steps lists the optional pipeline steps to run; empty runs all of them.
+	Steps []string `json:"steps,omitempty"`
+	// Profile names the encoding profile used by transcode; empty uses the default.
+	Profile     string            `json:"profile,omitempty"`
+	Thumbnails  *ThumbnailSpec    `json:"thumbnails,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Priority    Priority          `json:"priority,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Tenant routes the job to per-tenant sub-queues consumed round-robin;
+	// empty uses the shared queues.
+	Tenant string `json:"tenant,omitempty"`
+	// ExpiresAt is the deadline of the job (unix seconds); 0 means none. Jobs
+	// consumed after it are dropped as expired, and running jobs are stopped at it.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// ThumbnailSpec overrides the thumbnail settings; zero fields keep the defaults.
+type ThumbnailSpec struct {
+	Count  int `json:"count,omitempty"`
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// Validate checks the fields the queue depends on. Step and profile names are
+// validated by the producer against the processor package.
+func (s *JobSpec) Validate() error {
+	if s.Version > JobSpecVersion {
+		return fmt.Errorf("unsupported job spec version %d (max %d)", s.Version, JobSpecVersion)
+	}
+	if strings.TrimSpace(s.VideoID) == "" {
+		return fmt.Errorf("job spec has no video_id")
+	}
+	if s.Priority != "" && !ValidPriority(s.Priority) {
+		return fmt.Errorf("invalid priority %q", s.Priority)
+	}
+	if !validTenant(s.Tenant) {
+		return fmt.Errorf("invalid tenant %q (1-64 letters, digits, '-' or '_'; %q is reserved)", s.Tenant, DefaultTenant)
+	}
+	if s.ExpiresAt < 0 {
+		return fmt.Errorf("expires_at must not be negative")
+	}
+	if t := s.Thumbnails; t != nil {
+		if t.Count < 0 || t.Width < 0 || t.Height < 0 {
+			return fmt.Errorf("thumbnail settings must not be negative")
+		}
+		if t.Count > MaxThumbnailCount {
+			return fmt.Errorf("thumbnail count must be at most %d", MaxThumbnailCount)
+		}
+		if t.Width > MaxThumbnailDimension || t.Height > MaxThumbnailDimension {
+			return fmt.Errorf("thumbnail width and height must be at most %d", MaxThumbnailDimension)
+		}
+	}
+	return nil
+}
+
+// ParseJobSpec decodes a queue payload. JSON objects are decoded as a spec;
+// anything else is treated as a bare videoID.
+func ParseJobSpec(payload string) (*JobSpec, error) {
+	trimmed := strings.TrimSpace(payload)
+	if !strings.HasPrefix(trimmed, "{") {
+		spec := &JobSpec{VideoID: trimmed}
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+		return spec, nil
+	}
+
+	var spec JobSpec
+	if err := json.Unmarshal([]byte(trimmed), &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse job spec: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// encodeJobSpec returns the queue payload for spec. Legacy (version 0) specs
+// without options are encoded as the bare videoID they were parsed from.
+func encodeJobSpec(spec *JobSpec) (string, error) {
+	if spec.Version == 0 && isBareSpec(spec) {
+		return spec.VideoID, nil
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize job spec: %w", err)
+	}
+	return string(data), nil
+}
+
+func isBareSpec(spec *JobSpec) bool {
+	return len(spec.Steps) == 0 && spec.Profile == "" && spec.Thumbnails == nil &&
+		spec.CallbackURL == "" && spec.Priority == "" && len(spec.Metadata) == 0 && spec.Tenant == "" &&
+		spec.ExpiresAt == 0
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJobSpec_BareVideoID(t *testing.T) {
+	spec, err := ParseJobSpec("video-123")
+	if err != nil {
+		t.Fatalf("ParseJobSpec() failed: %v", err)
+	}
+	if spec.Version != 0 || spec.VideoID != "video-123" {
+		t.Errorf("expected legacy spec for video-123, got %+v", spec)
+	}
+}
+
+func TestParseJobSpec_JSON(t *testing.T) {
+	payload := `{"version":1,"video_id":"v1","steps":["thumbnails"],"profile":"high",` +
+		`"thumbnails":{"count":3},"callback_url":"http://api/cb","priority":"high","metadata":{"user":"42"}}`
+
+	spec, err := ParseJobSpec(payload)
+	if err != nil {
+		t.Fatalf("ParseJobSpec() failed: %v", err)
+	}
+	expected := &JobSpec{
+		Version:     1,
+		VideoID:     "v1",
+		Steps:       []string{"thumbnails"},
+		Profile:     "high",
+		Thumbnails:  &ThumbnailSpec{Count: 3},
+		CallbackURL: "http://api/cb",
+		Priority:    PriorityHigh,
+		Metadata:    map[string]string{"user": "42"},
+	}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("expected %+v, got %+v", expected, spec)
+	}
+}
+
+func TestParseJobSpec_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"empty":               "",
+		"malformed JSON":      `{"video_id":`,
+		"missing video_id":    `{"version":1}`,
+		"future version":      `{"version":99,"video_id":"v1"}`,
+		"invalid priority":    `{"video_id":"v1","priority":"urgent"}`,
+		"negative thumbnail":  `{"video_id":"v1","thumbnails":{"count":-1}}`,
+		"too many thumbnails": `{"video_id":"v1","thumbnails":{"count":1000000}}`,
+		"huge thumbnail":      `{"video_id":"v1","thumbnails":{"width":100000}}`,
+		"invalid tenant":      `{"video_id":"v1","tenant":"acme/eu"}`,
+		"reserved tenant":     `{"video_id":"v1","tenant":"default"}`,
+		"negative deadline":   `{"video_id":"v1","expires_at":-5}`,
+	}
+	for name, payload := range cases {
+		if _, err := ParseJobSpec(payload); err == nil {
+			t.Errorf("%s: ParseJobSpec(%q) should fail", name, payload)
+		}
+	}
+}
+
+func TestEncodeJobSpec_RoundTrip(t *testing.T) {
+	legacy := &JobSpec{VideoID: "v1"}
+	payload, err := encodeJobSpec(legacy)
+	if err != nil || payload != "v1" {
+		t.Fatalf("legacy spec should encode as bare videoID, got %q (err: %v)", payload, err)
+	}
+
+	spec := &JobSpec{Version: JobSpecVersion, VideoID: "v2", Profile: "fast", Priority: PriorityLow}
+	payload, err = encodeJobSpec(spec)
+	if err != nil {
+		t.Fatalf("encodeJobSpec() failed: %v", err)
+	}
+	decoded, err := ParseJobSpec(payload)
+	if err != nil {
+		t.Fatalf("ParseJobSpec() failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, spec) {
+		t.Errorf("expected %+v, got %+v", spec, decoded)
+	}
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamPayloadField is the entry field holding the job payload.
+	streamPayloadField = "payload"
+	// streamClaimBatchSize is the COUNT of each XAUTOCLAIM call made by InFlight.
+	streamClaimBatchSize = 100
+)
+
+// streamBackend delivers jobs through Redis Streams consumer groups.
+// The group's pending entries list (PEL) is the in-flight set: each entry has an
+// owning consumer, an idle time and a delivery count, and recovery takes over
+// stale entries with XAUTOCLAIM instead of scanning a side list.
+type streamBackend struct {
+	group    string
+	consumer string
+
+	// groups caches streams whose consumer group is known to exist.
+	groups sync.Map
+}
+
+func newStreamBackend(group, consumer string) *streamBackend {
+	return &streamBackend{group: group, consumer: consumer}
+}
+
+// streamKey returns the stream that backs queue. A separate key is used so a
+// producer that still LPUSHes onto the list does not hit WRONGTYPE errors.
+func streamKey(queue string) string {
+	return queueKey(queue, "stream")
+}
+
+// ensureGroup creates the consumer group (and the stream) if needed.
+// Starts at ID 0 so entries published before the first worker started are delivered.
+func (b *streamBackend) ensureGroup(ctx context.Context, stream string) error {
+	if _, ok := b.groups.Load(stream); ok {
+		return nil
+	}
+	err := client.XGroupCreateMkStream(ctx, stream, b.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s on %s: %w", b.group, stream, err)
+	}
+	b.groups.Store(stream, struct{}{})
+	return nil
+}
+
+func (b *streamBackend) Publish(ctx context.Context, queue, payload string) error {
+	return client.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(queue),
+		Values: map[string]interface{}{streamPayloadField: payload},
+	}).Err()
+}
+
+func (b *streamBackend) Consume(ctx context.Context, queue string, timeout time.Duration) (*Message, error) {
+	stream := streamKey(queue)
+	if err := b.ensureGroup(ctx, stream); err != nil {
+		return nil, err
+	}
+	// XREADGROUP omits BLOCK for a negative duration and blocks forever for zero.
+	block := timeout
+	if block < 0 {
+		block = -1
+	}
+	streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    b.group,
+		Consumer: b.consumer,
+		Streams:  []string{stream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			// Stream was deleted under us; recreate the group on the next call.
+			b.groups.Delete(stream)
+		}
+		return nil, err
+	}
+	for _, s := range streams {
+		for _, entry := range s.Messages {
+			return b.toMessage(queue, entry, 1), nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *streamBackend) toMessage(queue string, entry redis.XMessage, deliveries int64) *Message {
+	payload, _ := entry.Values[streamPayloadField].(string)
+	return &Message{
+		Payload:       payload,
+		Queue:         queue,
+		ID:            entry.ID,
+		DeliveryCount: deliveries,
+	}
+}
+
+// Ack acknowledges and deletes the entry so the stream only holds waiting and in-flight jobs.
+func (b *streamBackend) Ack(ctx context.Context, msg *Message) error {
+	stream := streamKey(msg.Queue)
+	pipe := client.TxPipeline()
+	pipe.XAck(ctx, stream, b.group, msg.ID)
+	pipe.XDel(ctx, stream, msg.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Len returns the entries not yet delivered: stream length minus the pending entries.
+func (b *streamBackend) Len(ctx context.Context, queue string) (int64, error) {
+	stream := streamKey(queue)
+	if err := b.ensureGroup(ctx, stream); err != nil {
+		return 0, err
+	}
+	length, err := client.XLen(ctx, stream).Result()
+	if err != nil {
+		return 0, err
+	}
+	pending, err := client.XPending(ctx, stream, b.group).Result()
+	if err != nil {
+		return 0, err
+	}
+	return length - pending.Count, nil
+}
+
+// InFlight takes over, with XAUTOCLAIM, the pending entries idle for at least
+// minIdle, walking each PEL with its cursor so none is left out however long it is.
+// Claiming resets their idle time, so concurrent recoveries on other instances skip
+// them, and leaves them pending: the original worker can still acknowledge them.
+func (b *streamBackend) InFlight(ctx context.Context, minIdle time.Duration) ([]*Message, error) {
+	queues, err := consumedQueues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*Message
+	for _, queue := range queues {
+		stream := streamKey(queue)
+		if err := b.ensureGroup(ctx, stream); err != nil {
+			return nil, err
+		}
+		cursor := "0-0"
+		for {
+			entries, next, err := client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   stream,
+				Group:    b.group,
+				Consumer: b.consumer,
+				MinIdle:  minIdle,
+				Start:    cursor,
+				Count:    streamClaimBatchSize,
+			}).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if _, ok := entry.Values[streamPayloadField]; !ok {
+					// Deleted while pending (Redis < 7 still returns it): drop it from the PEL.
+					client.XAck(ctx, stream, b.group, entry.ID)
+					continue
+				}
+				msgs = append(msgs, b.toMessage(queue, entry, 0))
+			}
+			if next == "0-0" {
+				break
+			}
+			cursor = next
+		}
+	}
+	return msgs, nil
+}
+
+// Reclaim acknowledges and deletes the entry. XACK only counts it once, so only
+// one of the original worker and the recovering instances gets true.
+func (b *streamBackend) Reclaim(ctx context.Context, msg *Message) (bool, error) {
+	stream := streamKey(msg.Queue)
+	acked, err := client.XAck(ctx, stream, b.group, msg.ID).Result()
+	if err != nil {
+		return false, err
+	}
+	if acked == 0 {
+		return false, nil
+	}
+	if err := client.XDel(ctx, stream, msg.ID).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove deletes stream entries carrying payload. Streams cannot be searched by
+// value, so this walks the whole stream; it is only used for cancellation.
+func (b *streamBackend) Remove(ctx context.Context, queue, payload string) (int64, error) {
+	stream := streamKey(queue)
+	entries, err := client.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if p, _ := entry.Values[streamPayloadField].(string); p == payload {
+			ids = append(ids, entry.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return client.XDel(ctx, stream, ids...).Result()
+}
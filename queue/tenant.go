@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultTenant is the metrics label of jobs without a tenant, which use the shared queues.
+	DefaultTenant = "default"
+
+	// tenantRetention is how long a tenant stays registered after its last publish
+	// once its queues are empty.
+	tenantRetention = 48 * time.Hour
+)
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// pruneTenantScript unregisters a tenant only if it has not published since the
+// caller read its score, so a concurrent publish can never be orphaned.
+var pruneTenantScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if score and tonumber(score) < tonumber(ARGV[2]) then
+	return redis.call("ZREM", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// validTenant reports whether t can be used as a tenant ID. Empty means no tenant.
+func validTenant(t string) bool {
+	return t == "" || (t != DefaultTenant && tenantPattern.MatchString(t))
+}
+
+// tenantsKey is the sorted set of tenants with queues, scored by their last publish (unix seconds).
+func tenantsKey() string {
+	return queueKey(cfg.ProcessingRequestQueue, "tenants")
+}
+
+// jobQueue returns the request queue for priority p and tenant. Jobs without a
+// tenant use the shared priority queues; each tenant gets its own sub-queue per
+// priority (<queue>:tenant:<id>, <queue>:high:tenant:<id>, <queue>:low:tenant:<id>).
+func jobQueue(p Priority, tenant string) string {
+	if tenant == "" {
+		return queueForPriority(p)
+	}
+	suffix := "tenant:" + tenant
+	if p == PriorityHigh || p == PriorityLow {
+		suffix = string(p) + ":" + suffix
+	}
+	return queueKey(cfg.ProcessingRequestQueue, suffix)
+}
+
+// publishToQueue publishes payload to the queue of p and tenant. The tenant is
+// registered first, so consumers always know every queue that may hold jobs.
+// Every publish path (submission, retry, recovery, redrive) goes through here.
+func publishToQueue(ctx context.Context, p Priority, tenant, payload string) error {
+	if tenant != "" {
+		if err := client.ZAdd(ctx, tenantsKey(), redis.Z{Score: float64(time.Now().Unix()), Member: tenant}).Err(); err != nil {
+			return fmt.Errorf("failed to register tenant: %w", err)
+		}
+	}
+	return backend.Publish(ctx, jobQueue(p, tenant), payload)
+}
+
+// tenants returns "" (no tenant) followed by the registered tenants, sorted.
+func tenants(ctx context.Context) ([]string, error) {
+	registered, err := client.ZRange(ctx, tenantsKey(), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	sort.Strings(registered)
+	return append([]string{""}, registered...), nil
+}
+
+// tenantRotation remembers, per priority, the tenant this process served last
+// so consumption round-robins across tenants instead of draining one at a time.
+type tenantRotation struct {
+	mu   sync.Mutex
+	last map[Priority]string
+}
+
+var rotation = &tenantRotation{last: map[Priority]string{}}
+
+// order returns the tenants (sorted) starting after the one served last for p.
+func (r *tenantRotation) order(p Priority, tenants []string) []string {
+	r.mu.Lock()
+	last, ok := r.last[p]
+	r.mu.Unlock()
+	if !ok {
+		return tenants
+	}
+	return rotateAfter(tenants, last)
+}
+
+func (r *tenantRotation) served(p Priority, tenant string) {
+	r.mu.Lock()
+	r.last[p] = tenant
+	r.mu.Unlock()
+}
+
+// rotateAfter rotates the sorted tenants so the first one greater than last
+// comes first. last need not be in the list (e.g. it was pruned meanwhile).
+func rotateAfter(tenants []string, last string) []string {
+	i := sort.SearchStrings(tenants, last)
+	if i < len(tenants) && tenants[i] == last {
+		i++
+	}
+	if i == len(tenants) {
+		return tenants
+	}
+	return append(append(make([]string, 0, len(tenants)), tenants[i:]...), tenants[:i]...)
+}
+
+// GetTenantQueueSizes returns the number of jobs waiting per tenant across all
+// priorities. Jobs without a tenant are reported under DefaultTenant.
+func GetTenantQueueSizes() (map[string]int64, error) {
+	ctx := context.Background()
+	all, err := tenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(all))
+	for _, tenant := range all {
+		var total int64
+		for _, p := range priorities {
+			size, err := backend.Len(ctx, jobQueue(p, tenant))
+			if err != nil {
+				return nil, err
+			}
+			total += size
+		}
+		label := tenant
+		if label == "" {
+			label = DefaultTenant
+		}
+		sizes[label] = total
+	}
+	return sizes, nil
+}
+
+// pruneIdleTenants unregisters tenants whose queues are empty and that have not
+// published for tenantRetention, keeping the consume loop short.
+func pruneIdleTenants(ctx context.Context) {
+	cutoff := time.Now().Add(-tenantRetention).Unix()
+	idle, err := client.ZRangeByScore(ctx, tenantsKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("(%d", cutoff),
+	}).Result()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read idle tenants")
+		return
+	}
+	for _, tenant := range idle {
+		if waiting, err := tenantHasJobs(ctx, tenant); err != nil || waiting {
+			continue
+		}
+		if err := pruneTenantScript.Run(ctx, client, []string{tenantsKey()}, tenant, cutoff).Err(); err != nil {
+			log.Warn().Err(err).Str("tenant", tenant).Msg("Failed to unregister idle tenant")
+			continue
+		}
+		log.Info().Str("tenant", tenant).Msg("Unregistered idle tenant")
+	}
+}
+
+func tenantHasJobs(ctx context.Context, tenant string) (bool, error) {
+	for _, p := range priorities {
+		size, err := backend.Len(ctx, jobQueue(p, tenant))
+		if err != nil || size > 0 {
+			return size > 0, err
+		}
+	}
+	return false, nil
+}
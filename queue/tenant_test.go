@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+
+	"video-processor/config"
+)
+
+func TestRotateAfter(t *testing.T) {
+	tenants := []string{"", "acme", "globex", "initech"}
+
+	cases := []struct {
+		last     string
+		expected []string
+	}{
+		{"", []string{"acme", "globex", "initech", ""}},
+		{"globex", []string{"initech", "", "acme", "globex"}},
+		{"initech", []string{"", "acme", "globex", "initech"}},
+		// A tenant pruned since it was served keeps its place in the rotation.
+		{"hooli", []string{"initech", "", "acme", "globex"}},
+	}
+	for _, c := range cases {
+		if got := rotateAfter(tenants, c.last); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("rotateAfter(%q) = %q, expected %q", c.last, got, c.expected)
+		}
+	}
+}
+
+func TestTenantRotation_RoundRobinPerPriority(t *testing.T) {
+	r := &tenantRotation{last: map[Priority]string{}}
+	tenants := []string{"", "a", "b"}
+
+	if got := r.order(PriorityNormal, tenants); got[0] != "" {
+		t.Fatalf("expected the first pass to start with the shared queue, got %q", got)
+	}
+	r.served(PriorityNormal, "a")
+	if got := r.order(PriorityNormal, tenants); got[0] != "b" {
+		t.Errorf("expected b after a, got %q", got)
+	}
+	if got := r.order(PriorityHigh, tenants); got[0] != "" {
+		t.Errorf("expected priorities to rotate independently, got %q", got)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	prev := cfg
+	defer func() { cfg = prev }()
+	cfg = &config.Config{ProcessingRequestQueue: "video_queue"}
+
+	cases := []struct {
+		priority Priority
+		tenant   string
+		expected string
+	}{
+		{PriorityNormal, "", "video_queue"},
+		{PriorityHigh, "", "video_queue:high"},
+		{PriorityNormal, "acme", "video_queue:tenant:acme"},
+		{PriorityLow, "acme", "video_queue:low:tenant:acme"},
+	}
+	for _, c := range cases {
+		if got := jobQueue(c.priority, c.tenant); got != c.expected {
+			t.Errorf("jobQueue(%s, %q) = %s, expected %s", c.priority, c.tenant, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-processor/config"
+	"video-processor/minio"
+)
+
+func TestCheckpoints_SaveRestore(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	minio.InitMinioClient(&config.Config{
+		MinioEndpoint:     tc.MinioHost,
+		MinioRootUser:     tc.MinioUser,
+		MinioRootPassword: tc.MinioPass,
+		MinioBucketName:   "checkpoints",
+	})
+	ctx := context.Background()
+
+	src := t.TempDir()
+	video := filepath.Join(src, "video.mp4")
+	hls := filepath.Join(src, "streaming")
+	for path, content := range map[string]string{
+		video:                             "mp4 data",
+		filepath.Join(hls, "master.m3u8"): "#EXTM3U\n240p/playlist.m3u8\n",
+		filepath.Join(hls, "240p", "playlist.m3u8"):  "#EXTM3U\n",
+		filepath.Join(hls, "240p", "segment_000.ts"): "ts data",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := minio.Checkpoints{VideoID: "resumed-video", Attempt: 1, Fingerprint: "2-abc"}
+	if err := first.Save(ctx, "transcode", map[string]string{"video": video}); err != nil {
+		t.Fatalf("Save(transcode) failed: %v", err)
+	}
+	if err := first.Save(ctx, "streaming", map[string]string{"streaming": hls}); err != nil {
+		t.Fatalf("Save(streaming) failed: %v", err)
+	}
+
+	dst := t.TempDir()
+	retry := minio.Checkpoints{VideoID: "resumed-video", Attempt: 3, Fingerprint: "2-abc"}
+	ok, err := retry.Restore(ctx, "transcode", map[string]string{"video": filepath.Join(dst, "out.mp4")})
+	if err != nil || !ok {
+		t.Fatalf("Restore(transcode) = %v, %v; expected the checkpoint of attempt 1", ok, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "out.mp4")); string(data) != "mp4 data" {
+		t.Errorf("unexpected restored video %q", data)
+	}
+	ok, err = retry.Restore(ctx, "streaming", map[string]string{"streaming": filepath.Join(dst, "streaming")})
+	if err != nil || !ok {
+		t.Fatalf("Restore(streaming) = %v, %v", ok, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "streaming", "240p", "segment_000.ts")); string(data) != "ts data" {
+		t.Errorf("unexpected restored segment %q", data)
+	}
+
+	other := minio.Checkpoints{VideoID: "resumed-video", Attempt: 2, Fingerprint: "3-def"}
+	if ok, err := other.Restore(ctx, "transcode", map[string]string{"video": filepath.Join(dst, "other.mp4")}); ok || err != nil {
+		t.Errorf("expected a checkpoint with other settings to be ignored, got %v, %v", ok, err)
+	}
+
+	if err := minio.DeleteCheckpoints(ctx, "resumed-video"); err != nil {
+		t.Fatalf("DeleteCheckpoints() failed: %v", err)
+	}
+	if ok, err := retry.Restore(ctx, "transcode", map[string]string{"video": filepath.Join(dst, "out.mp4")}); ok || err != nil {
+		t.Errorf("expected no checkpoint after DeleteCheckpoints, got %v, %v", ok, err)
+	}
+}
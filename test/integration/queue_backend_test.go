@@ -0,0 +1,634 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"video-processor/config"
+	"video-processor/internal/joberrors"
+	"video-processor/minio"
+	"video-processor/queue"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// initQueue points the queue package at the test Redis container using the given backend.
+func initQueue(t *testing.T, tc *TestContainers, backendName string) *config.Config {
+	t.Helper()
+	cfg := &config.Config{
+		RedisHost:               tc.RedisHost,
+		ProcessingRequestQueue:  "video_queue",
+		ProcessingFinishedQueue: "video_success_queue",
+		QueueBackend:            backendName,
+		RedisStreamGroup:        "video-processor-test",
+	}
+	queue.InitRedisClient(cfg)
+	return cfg
+}
+
+func TestQueueBackends_PublishConsumeAck(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+
+	for _, backendName := range []string{queue.BackendList, queue.BackendStreams} {
+		t.Run(backendName, func(t *testing.T) {
+			initQueue(t, tc, backendName)
+			videoID := "backend-" + backendName
+
+			if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+				t.Fatalf("PublishJob() failed: %v", err)
+			}
+			if size, err := queue.GetQueueSize(); err != nil || size != 1 {
+				t.Fatalf("expected queue size 1, got %d (err: %v)", size, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			msg, err := queue.ConsumeMessage(ctx)
+			if err != nil {
+				t.Fatalf("ConsumeMessage() failed: %v", err)
+			}
+			if msg.VideoID != videoID {
+				t.Fatalf("expected videoID %q, got %q", videoID, msg.VideoID)
+			}
+			if size, err := queue.GetQueueSize(); err != nil || size != 0 {
+				t.Fatalf("expected queue size 0 while in flight, got %d (err: %v)", size, err)
+			}
+
+			if err := queue.AcknowledgeMessage(msg); err != nil {
+				t.Fatalf("AcknowledgeMessage() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueBackends_CancelPendingJob(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+
+	for _, backendName := range []string{queue.BackendList, queue.BackendStreams} {
+		t.Run(backendName, func(t *testing.T) {
+			initQueue(t, tc, backendName)
+			videoID := "cancel-" + backendName
+
+			if err := queue.PublishJob(queue.JobSpec{VideoID: videoID, Metadata: map[string]string{"k": "v"}}); err != nil {
+				t.Fatalf("PublishJob() failed: %v", err)
+			}
+
+			state, err := queue.CancelJob(videoID)
+			if err != nil {
+				t.Fatalf("CancelJob() failed: %v", err)
+			}
+			if state.Status != queue.JobStatusCancelled {
+				t.Fatalf("expected status cancelled, got %s", state.Status)
+			}
+			if size, err := queue.GetQueueSize(); err != nil || size != 0 {
+				t.Fatalf("expected empty queue after cancel, got %d (err: %v)", size, err)
+			}
+			if _, err := queue.CancelJob(videoID); !errors.Is(err, queue.ErrJobNotCancellable) {
+				t.Fatalf("expected ErrJobNotCancellable on second cancel, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJobEvents_AttemptHistory(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "history-video"
+
+	if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	owner := queue.NewJobOwner(1)
+	for attempt := 1; attempt <= 2; attempt++ {
+		if _, err := queue.SetJobProcessing(videoID, owner); err != nil {
+			t.Fatalf("SetJobProcessing() failed: %v", err)
+		}
+		if _, err := queue.SetJobFailed(videoID, fmt.Errorf("boom %d", attempt)); err != nil {
+			t.Fatalf("SetJobFailed() failed: %v", err)
+		}
+	}
+
+	events, err := queue.GetJobEvents(videoID)
+	if err != nil {
+		t.Fatalf("GetJobEvents() failed: %v", err)
+	}
+	want := []queue.JobEventType{queue.EventSubmitted, queue.EventStarted, queue.EventFailed, queue.EventStarted, queue.EventFailed}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Errorf("event %d: expected %s, got %s", i, want[i], e.Type)
+		}
+	}
+	if events[4].Attempt != 2 || events[4].Error != "boom 2" {
+		t.Errorf("expected second failure to record attempt 2 with its error, got %+v", events[4])
+	}
+	if events[2].Error != "boom 1" {
+		t.Errorf("expected first attempt error to be kept, got %q", events[2].Error)
+	}
+}
+
+func TestSetJobFailed_RecordsErrorCode(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "corrupt-video"
+
+	if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	jobErr := fmt.Errorf("failed to process video: %w",
+		joberrors.Permanent(joberrors.CodeInvalidInput, errors.New("moov atom not found")))
+	state, err := queue.SetJobFailed(videoID, jobErr)
+	if err != nil {
+		t.Fatalf("SetJobFailed() failed: %v", err)
+	}
+	if state.ErrorCode != joberrors.CodeInvalidInput {
+		t.Errorf("expected error code %s, got %q", joberrors.CodeInvalidInput, state.ErrorCode)
+	}
+	if state.RetryCount != 0 {
+		t.Errorf("expected a permanent failure not to count as a retry, got retry_count %d", state.RetryCount)
+	}
+
+	events, err := queue.GetJobEvents(videoID)
+	if err != nil {
+		t.Fatalf("GetJobEvents() failed: %v", err)
+	}
+	last := events[len(events)-1]
+	if last.Type != queue.EventFailed || last.ErrorCode != joberrors.CodeInvalidInput {
+		t.Errorf("expected failed event with code %s, got %+v", joberrors.CodeInvalidInput, last)
+	}
+}
+
+func TestListJobs_StatusIndexes(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+
+	for _, id := range []string{"index-a", "index-b", "index-c"} {
+		if err := queue.PublishJob(queue.JobSpec{VideoID: id}); err != nil {
+			t.Fatalf("PublishJob(%s) failed: %v", id, err)
+		}
+	}
+	if _, err := queue.SetJobProcessing("index-b", queue.NewJobOwner(1)); err != nil {
+		t.Fatalf("SetJobProcessing() failed: %v", err)
+	}
+	if _, err := queue.SetJobFailed("index-b", errors.New("boom")); err != nil {
+		t.Fatalf("SetJobFailed() failed: %v", err)
+	}
+
+	failed, err := queue.ListJobs(queue.JobStatusFailed, time.Time{}, "", 10)
+	if err != nil {
+		t.Fatalf("ListJobs(failed) failed: %v", err)
+	}
+	if len(failed.Jobs) != 1 || failed.Jobs[0].VideoID != "index-b" {
+		t.Errorf("expected only index-b to be failed, got %+v", failed.Jobs)
+	}
+	processing, err := queue.ListJobs(queue.JobStatusProcessing, time.Time{}, "", 10)
+	if err != nil {
+		t.Fatalf("ListJobs(processing) failed: %v", err)
+	}
+	if len(processing.Jobs) != 0 {
+		t.Errorf("expected index-b to have left the processing index, got %+v", processing.Jobs)
+	}
+
+	// Page through every status one job at a time.
+	seen := map[string]bool{}
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		page, err := queue.ListJobs("", time.Time{}, cursor, 1)
+		if err != nil {
+			t.Fatalf("ListJobs() failed: %v", err)
+		}
+		for _, job := range page.Jobs {
+			if seen[job.VideoID] {
+				t.Errorf("job %s returned twice", job.VideoID)
+			}
+			seen[job.VideoID] = true
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected 3 jobs across pages, got %v", seen)
+	}
+
+	future, err := queue.ListJobs("", time.Now().Add(time.Hour), "", 10)
+	if err != nil {
+		t.Fatalf("ListJobs(since) failed: %v", err)
+	}
+	if len(future.Jobs) != 0 {
+		t.Errorf("expected no jobs updated in the future, got %+v", future.Jobs)
+	}
+}
+
+func TestConsumeMessage_RoundRobinAcrossTenants(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+
+	for i := 1; i <= 3; i++ {
+		spec := queue.JobSpec{VideoID: fmt.Sprintf("bulk-%d", i), Tenant: "bulk"}
+		if err := queue.PublishJob(spec); err != nil {
+			t.Fatalf("PublishJob(%s) failed: %v", spec.VideoID, err)
+		}
+	}
+	if err := queue.PublishJob(queue.JobSpec{VideoID: "small-1", Tenant: "small"}); err != nil {
+		t.Fatalf("PublishJob(small-1) failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	served := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		msg, err := queue.ConsumeMessage(ctx)
+		if err != nil {
+			t.Fatalf("ConsumeMessage() failed: %v", err)
+		}
+		served[msg.Spec.Tenant] = true
+	}
+	if !served["bulk"] || !served["small"] {
+		t.Errorf("expected the first two jobs to come from different tenants, got %v", served)
+	}
+
+	sizes, err := queue.GetTenantQueueSizes()
+	if err != nil {
+		t.Fatalf("GetTenantQueueSizes() failed: %v", err)
+	}
+	if sizes["bulk"] != 2 || sizes["small"] != 0 || sizes[queue.DefaultTenant] != 0 {
+		t.Errorf("unexpected tenant queue sizes: %v", sizes)
+	}
+}
+
+func TestGetJobState_FallsBackToArchive(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	cfg := initQueue(t, tc, queue.BackendList)
+	cfg.MinioEndpoint = tc.MinioHost
+	cfg.MinioRootUser = tc.MinioUser
+	cfg.MinioRootPassword = tc.MinioPass
+	cfg.MinioBucketName = "job-archive"
+	minio.InitMinioClient(cfg)
+	queue.SetJobArchive(minio.JobRecords{})
+	defer queue.SetJobArchive(nil)
+	videoID := "archived-video"
+
+	if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	if err := queue.SetJobDone(videoID, queue.JobArtifacts{Video: "processed/" + videoID + ".mp4"}, nil); err != nil {
+		t.Fatalf("SetJobDone() failed: %v", err)
+	}
+
+	// Simulate the expiry of the Redis state.
+	client := redis.NewClient(&redis.Options{Addr: tc.RedisHost})
+	defer client.Close()
+	if err := client.Del(context.Background(), "job:"+videoID).Err(); err != nil {
+		t.Fatalf("failed to delete job key: %v", err)
+	}
+
+	state, err := queue.GetJobState(videoID)
+	if err != nil {
+		t.Fatalf("GetJobState() failed: %v", err)
+	}
+	if state.Status != queue.JobStatusDone || state.Artifacts == nil || state.Artifacts.Video != "processed/"+videoID+".mp4" {
+		t.Errorf("expected the archived done state, got %+v", state)
+	}
+	if _, err := queue.GetJobState("never-submitted"); !errors.Is(err, queue.ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound for an unknown job, got %v", err)
+	}
+}
+
+func TestSetJobProcessing_IgnoresArchivedRun(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	cfg := initQueue(t, tc, queue.BackendList)
+	cfg.MinioEndpoint = tc.MinioHost
+	cfg.MinioRootUser = tc.MinioUser
+	cfg.MinioRootPassword = tc.MinioPass
+	cfg.MinioBucketName = "job-archive"
+	minio.InitMinioClient(cfg)
+	queue.SetJobArchive(minio.JobRecords{})
+	defer queue.SetJobArchive(nil)
+	videoID := "rerun-video"
+
+	spec := queue.JobSpec{VideoID: videoID}
+	if err := queue.PublishJob(spec); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	if _, err := queue.SetJobFailed(videoID, errors.New("ffmpeg crashed")); err != nil {
+		t.Fatalf("SetJobFailed() failed: %v", err)
+	}
+	if err := queue.MoveToDLQ(&spec); err != nil {
+		t.Fatalf("MoveToDLQ() failed: %v", err)
+	}
+
+	// Simulate the expiry of the Redis state, leaving the archived failed run.
+	client := redis.NewClient(&redis.Options{Addr: tc.RedisHost})
+	defer client.Close()
+	if err := client.Del(context.Background(), "job:"+videoID).Err(); err != nil {
+		t.Fatalf("failed to delete job key: %v", err)
+	}
+	if state, err := queue.GetJobState(videoID); err != nil || state.RetryCount != 1 {
+		t.Fatalf("expected the archived failed state, got %+v (%v)", state, err)
+	}
+
+	state, err := queue.SetJobProcessing(videoID, queue.NewJobOwner(1))
+	if err != nil {
+		t.Fatalf("SetJobProcessing() failed: %v", err)
+	}
+	if state.RetryCount != 0 || state.Error != "" || state.ErrorCode != "" {
+		t.Errorf("expected a fresh state, got %+v", state)
+	}
+}
+
+func TestSetJobExpired_IsTerminal(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "stale-video"
+
+	spec := queue.JobSpec{VideoID: videoID, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	if err := queue.PublishJob(spec); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	state, err := queue.SetJobExpired(videoID)
+	if err != nil {
+		t.Fatalf("SetJobExpired() failed: %v", err)
+	}
+	if state.Status != queue.JobStatusExpired || state.Spec == nil || state.Spec.ExpiresAt != spec.ExpiresAt {
+		t.Errorf("expected expired state keeping its spec, got %+v", state)
+	}
+
+	page, err := queue.ListJobs(queue.JobStatusExpired, time.Time{}, "", 10)
+	if err != nil {
+		t.Fatalf("ListJobs() failed: %v", err)
+	}
+	if len(page.Jobs) != 1 || page.Jobs[0].VideoID != videoID {
+		t.Errorf("expected the job in the expired index, got %+v", page.Jobs)
+	}
+	if _, err := queue.CancelJob(videoID); !errors.Is(err, queue.ErrJobNotCancellable) {
+		t.Errorf("expected ErrJobNotCancellable for an expired job, got %v", err)
+	}
+}
+
+func TestPublishJob_ClaimsOnce(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "claimed-video"
+
+	const submissions = 8
+	errs := make(chan error, submissions)
+	for i := 0; i < submissions; i++ {
+		go func() { errs <- queue.PublishJob(queue.JobSpec{VideoID: videoID}) }()
+	}
+	published := 0
+	for i := 0; i < submissions; i++ {
+		err := <-errs
+		switch {
+		case err == nil:
+			published++
+		case !errors.Is(err, queue.ErrJobActive):
+			t.Errorf("expected ErrJobActive, got %v", err)
+		}
+	}
+	if published != 1 {
+		t.Fatalf("expected exactly one submission to win, got %d", published)
+	}
+	if size, err := queue.GetQueueSize(); err != nil || size != 1 {
+		t.Errorf("expected one queued job, got %d (%v)", size, err)
+	}
+
+	// A finished job can be submitted again.
+	if err := queue.SetJobDone(videoID, queue.JobArtifacts{}, nil); err != nil {
+		t.Fatalf("SetJobDone() failed: %v", err)
+	}
+	if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+		t.Errorf("expected resubmission of a done job to succeed, got %v", err)
+	}
+}
+
+func TestRedriveDLQ_RestoresSpecAfterStateExpiry(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "dead-video"
+
+	spec := queue.JobSpec{VideoID: videoID, Profile: "high", Steps: []string{"thumbnails"}, Tenant: "acme", CallbackURL: "http://api/cb"}
+	if err := queue.PublishJob(spec); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := queue.ConsumeMessage(ctx)
+	if err != nil || msg == nil {
+		t.Fatalf("ConsumeMessage() failed: %v", err)
+	}
+	if err := queue.MoveToDLQ(msg.Spec); err != nil {
+		t.Fatalf("MoveToDLQ() failed: %v", err)
+	}
+	if err := queue.AcknowledgeMessage(msg); err != nil {
+		t.Fatalf("AcknowledgeMessage() failed: %v", err)
+	}
+
+	// Simulate the expiry of the Redis state.
+	client := redis.NewClient(&redis.Options{Addr: tc.RedisHost})
+	defer client.Close()
+	if err := client.Del(context.Background(), "job:"+videoID).Err(); err != nil {
+		t.Fatalf("failed to delete job key: %v", err)
+	}
+
+	redriven, err := queue.RedriveDLQ([]string{videoID})
+	if err != nil || len(redriven) != 1 {
+		t.Fatalf("RedriveDLQ() = %v, %v", redriven, err)
+	}
+	msg, err = queue.ConsumeMessage(ctx)
+	if err != nil || msg == nil {
+		t.Fatalf("ConsumeMessage() after redrive failed: %v", err)
+	}
+	got := msg.Spec
+	if got.Profile != "high" || got.Tenant != "acme" || got.CallbackURL != "http://api/cb" || len(got.Steps) != 1 {
+		t.Errorf("expected the original spec to be redriven, got %+v", got)
+	}
+	if size, err := queue.GetDLQSize(); err != nil || size != 0 {
+		t.Errorf("expected an empty dead letter queue, got %d (%v)", size, err)
+	}
+}
+
+func TestRedriveDLQ_SkipsActiveJob(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	initQueue(t, tc, queue.BackendList)
+	videoID := "resubmitted-video"
+
+	spec := queue.JobSpec{VideoID: videoID}
+	if err := queue.PublishJob(spec); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := queue.ConsumeMessage(ctx)
+	if err != nil || msg == nil {
+		t.Fatalf("ConsumeMessage() failed: %v", err)
+	}
+	if _, err := queue.SetJobFailed(videoID, errors.New("ffmpeg crashed")); err != nil {
+		t.Fatalf("SetJobFailed() failed: %v", err)
+	}
+	if err := queue.MoveToDLQ(msg.Spec); err != nil {
+		t.Fatalf("MoveToDLQ() failed: %v", err)
+	}
+	if err := queue.AcknowledgeMessage(msg); err != nil {
+		t.Fatalf("AcknowledgeMessage() failed: %v", err)
+	}
+
+	// The video is resubmitted before the dead letter entry is redriven.
+	if err := queue.PublishJob(spec); err != nil {
+		t.Fatalf("PublishJob() of the resubmission failed: %v", err)
+	}
+	redriven, err := queue.RedriveDLQ(nil)
+	if err != nil || len(redriven) != 0 {
+		t.Fatalf("expected the active job to be skipped, got %v, %v", redriven, err)
+	}
+	if size, err := queue.GetQueueSize(); err != nil || size != 1 {
+		t.Errorf("expected only the resubmission in the queue, got %d (%v)", size, err)
+	}
+	if size, err := queue.GetDLQSize(); err != nil || size != 1 {
+		t.Errorf("expected the entry to stay in the dead letter queue, got %d (%v)", size, err)
+	}
+}
+
+func TestLease_LostCancelsContext(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	cfg := initQueue(t, tc, queue.BackendList)
+	cfg.JobLeaseTTL = 300 * time.Millisecond
+	videoID := "leased-video"
+
+	lease, err := queue.AcquireLease(videoID, queue.NewJobOwner(1))
+	if err != nil {
+		t.Fatalf("AcquireLease() failed: %v", err)
+	}
+	defer lease.Release()
+	ctx, cancel := lease.Context(context.Background())
+	defer cancel()
+
+	// Another worker takes the job over after the lease expired.
+	client := redis.NewClient(&redis.Options{Addr: tc.RedisHost})
+	defer client.Close()
+	if err := client.Set(context.Background(), "lease:"+videoID, "other-instance/2", time.Minute).Err(); err != nil {
+		t.Fatalf("failed to overwrite lease: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		if !errors.Is(context.Cause(ctx), queue.ErrLeaseLost) {
+			t.Errorf("expected cause ErrLeaseLost, got %v", context.Cause(ctx))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the context to be cancelled once the lease was lost")
+	}
+	lease.Release()
+	if owner, err := client.Get(context.Background(), "lease:"+videoID).Result(); err != nil || owner != "other-instance/2" {
+		t.Errorf("expected the new owner's lease to be kept, got %q (%v)", owner, err)
+	}
+}
+
+func TestStreamRecovery_RequeuesEveryOrphan(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	cfg := initQueue(t, tc, queue.BackendStreams)
+	cfg.JobLeaseTTL = 200 * time.Millisecond
+
+	// More orphans than one XAUTOCLAIM batch, so recovery has to follow the cursor.
+	const jobs = 150
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < jobs; i++ {
+		videoID := fmt.Sprintf("orphan-%03d", i)
+		if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+			t.Fatalf("PublishJob() failed: %v", err)
+		}
+		msg, err := queue.ConsumeMessage(ctx)
+		if err != nil || msg == nil {
+			t.Fatalf("ConsumeMessage() failed: %v", err)
+		}
+		// The worker died after marking the job processing: no lease is held.
+		if _, err := queue.SetJobProcessing(msg.VideoID, queue.NewJobOwner(1)); err != nil {
+			t.Fatalf("SetJobProcessing() failed: %v", err)
+		}
+	}
+
+	recoveryCtx, stop := context.WithCancel(ctx)
+	go queue.StartRecovery(recoveryCtx, nil)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		size, err := queue.GetQueueSize()
+		if err == nil && size == jobs {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d requeued jobs, got %d (%v)", jobs, size, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	state, err := queue.GetJobState("orphan-149")
+	if err != nil || state.Status != queue.JobStatusPending || state.RetryCount != 1 {
+		t.Errorf("expected the orphan to be pending with one retry, got %+v (%v)", state, err)
+	}
+}
+
+func TestRecovery_DeadLettersExhaustedOrphan(t *testing.T) {
+	tc := SetupContainers(t)
+	defer TeardownContainers(t, tc)
+	cfg := initQueue(t, tc, queue.BackendList)
+	cfg.JobLeaseTTL = 200 * time.Millisecond
+	videoID := "crashing-video"
+
+	if err := queue.PublishJob(queue.JobSpec{VideoID: videoID}); err != nil {
+		t.Fatalf("PublishJob() failed: %v", err)
+	}
+	// Every retry is already used up.
+	for i := 0; i < queue.MaxJobRetries; i++ {
+		if _, err := queue.SetJobFailed(videoID, errors.New("worker crashed")); err != nil {
+			t.Fatalf("SetJobFailed() failed: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := queue.ConsumeMessage(ctx)
+	if err != nil || msg == nil {
+		t.Fatalf("ConsumeMessage() failed: %v", err)
+	}
+	if _, err := queue.SetJobProcessing(videoID, queue.NewJobOwner(1)); err != nil {
+		t.Fatalf("SetJobProcessing() failed: %v", err)
+	}
+
+	deadLettered := make(chan *queue.JobState, 1)
+	go queue.StartRecovery(ctx, func(state *queue.JobState) { deadLettered <- state })
+
+	select {
+	case state := <-deadLettered:
+		if state.Status != queue.JobStatusFailed || state.RetryCount != queue.MaxJobRetries+1 {
+			t.Errorf("expected a failed state past the retry limit, got %+v", state)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the orphan to be moved to the dead letter queue")
+	}
+	if size, err := queue.GetDLQSize(); err != nil || size != 1 {
+		t.Errorf("expected one dead letter entry, got %d (%v)", size, err)
+	}
+	if size, err := queue.GetQueueSize(); err != nil || size != 0 {
+		t.Errorf("expected the orphan not to be requeued, got %d (%v)", size, err)
+	}
+}